@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/store"
+)
+
+// Source is what triggered a change
+type Source string
+
+const (
+	SourceSlash     Source = "slash"
+	SourceButton    Source = "button"
+	SourceAPI       Source = "api"
+	SourceScheduler Source = "scheduler"
+	SourceEvent     Source = "event"
+)
+
+// Entry is one audited action
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Team   string    `json:"team,omitempty"`
+	Actor  string    `json:"actor"`            // who did it
+	Target string    `json:"target,omitempty"` // whose state changed
+	Action string    `json:"action"`           // e.g. "presence.afk", "attendance.append"
+	Source Source    `json:"source"`
+	Before string    `json:"before,omitempty"`
+	After  string    `json:"after,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// users returns the users the entry concerns, without duplicates
+func (e Entry) users() []string {
+	var users []string
+	if e.Actor != "" {
+		users = append(users, e.Actor)
+	}
+	if e.Target != "" && e.Target != e.Actor {
+		users = append(users, e.Target)
+	}
+	return users
+}
+
+// Backend stores audit entries append-only
+type Backend interface {
+	Append(ctx context.Context, e Entry) error
+	// History returns the latest entries of the team concerning a user, newest first
+	History(ctx context.Context, team, userID string, limit int) ([]Entry, error)
+}
+
+// Logger records entries of one workspace. A nil Logger records nothing.
+type Logger struct {
+	backend Backend
+	team    string
+}
+
+func NewLogger(backend Backend, teamID string) *Logger {
+	return &Logger{backend: backend, team: teamID}
+}
+
+// Record appends an entry. Failures are only logged so that auditing never blocks the action itself.
+func (l *Logger) Record(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Team = l.team
+	if err := l.backend.Append(context.Background(), e); err != nil {
+		slog.Error("Failed to write audit entry", slog.String("action", e.Action), slog.Any("error", err))
+	}
+}
+
+// History returns the latest entries concerning a user, newest first
+func (l *Logger) History(ctx context.Context, userID string, limit int) ([]Entry, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return l.backend.History(ctx, l.team, userID, limit)
+}
+
+// storeBackend keeps entries in streams of the store (Redis streams or SQLite rows):
+// one for the workspace and one per user
+type storeBackend struct {
+	redisClient store.Store
+}
+
+// NewStoreBackend stores entries in the streams of a team's store
+func NewStoreBackend(redisClient store.Store) Backend {
+	return &storeBackend{redisClient: redisClient}
+}
+
+func (b *storeBackend) Append(ctx context.Context, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.redisClient.AppendAudit(ctx, e.users(), string(data))
+}
+
+func (b *storeBackend) History(ctx context.Context, team, userID string, limit int) ([]Entry, error) {
+	values, err := b.redisClient.AuditHistory(ctx, userID, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(values))
+	for _, v := range values {
+		var e Entry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// fileBackend appends entries to a JSON Lines file shared by all workspaces
+type fileBackend struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileBackend appends entries to the file at path, creating it if needed
+func NewFileBackend(path string) (Backend, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &fileBackend{path: path, file: f}, nil
+}
+
+func (b *fileBackend) Append(ctx context.Context, e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err = b.file.Write(append(data, '\n'))
+	return err
+}
+
+func (b *fileBackend) History(ctx context.Context, team, userID string, limit int) ([]Entry, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// keep the last limit entries in a ring while scanning from the start
+	ring := make([]Entry, 0, limit)
+	next := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Team != team || (e.Actor != userID && e.Target != userID) {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, e)
+		} else if limit > 0 {
+			ring[next] = e
+			next = (next + 1) % limit
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(ring))
+	for i := len(ring) - 1; i >= 0; i-- {
+		entries = append(entries, ring[(next+i)%len(ring)])
+	}
+	return entries, nil
+}
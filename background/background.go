@@ -0,0 +1,42 @@
+// Package background tracks work that outlives the request that started it,
+// such as attendance writes and scheduled jobs, so that shutdown can wait for it.
+package background
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+var wg sync.WaitGroup
+
+// Go runs fn in a new goroutine and tracks it until it returns.
+// name is only used to log a panic.
+func Go(name string, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Recovered from panic in background task", slog.String("task", name), slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			}
+		}()
+		fn()
+	}()
+}
+
+// Wait blocks until every tracked goroutine has returned or ctx is done
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,324 @@
+// Package catalog describes the statuses users can set besides working and finished:
+// their attendance type, emoji, default duration, whether they count as a break,
+// and how they are announced. /afk and /lunch are built in; AFK_STATUS_CATALOG adds more.
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const fileEnv = "AFK_STATUS_CATALOG"
+
+// Names of the statuses whose commands existed before the catalog
+const (
+	Afk   = "afk"
+	Lunch = "lunch"
+)
+
+// Entry is one status of the catalog
+type Entry struct {
+	Name         string        // command word: /<name> and /afk --type <name>
+	Type         string        // 種別 written to the attendance sheet
+	Emoji        string        // e.g. ":calendar:"
+	Duration     time.Duration // default auto-response duration; zero lasts until /comeback
+	Break        bool          // the time until the next status or /comeback is not work time
+	Away         string        // predicate of the auto-response: "<user> は<Away>。"
+	Announcement string        // text/template of the channel post, see AnnouncementData
+	Description  string        // shown by "/<name> help"; generated when empty
+
+	announcement *template.Template
+}
+
+// AnnouncementData is what an announcement template can use
+type AnnouncementData struct {
+	User  string
+	Text  string // message given with the command, may be empty
+	Emoji string
+	Type  string
+	Until string // "15:04" when the status ends by itself, empty otherwise
+}
+
+// defaultAnnouncement is used by entries without an announcement
+const defaultAnnouncement = "{{.Emoji}} *{{.User}}が{{.Type}}中です*{{if .Text}}\n「{{.Text}}」{{end}}"
+
+// builtin is the catalog without AFK_STATUS_CATALOG. Changing the type of an entry would
+// stop the rows already written with it from counting, so the built-in types are fixed.
+var builtin = []Entry{
+	{
+		Name:         Afk,
+		Type:         "離席",
+		Emoji:        ":walking:",
+		Break:        true,
+		Away:         "席を外しています",
+		Announcement: ":walking: *{{.User}}が離席しました*\n{{if .Text}}「{{.Text}}」{{else}}代わりに不在をお伝えします{{end}}",
+		Description:  "離席状態にします。時間を指定するとその時間が過ぎたら自動で解除します",
+	},
+	{
+		Name:         Lunch,
+		Type:         "外出",
+		Emoji:        ":bento:",
+		Duration:     time.Hour,
+		Break:        true,
+		Away:         "ランチに行っています",
+		Announcement: ":bento: *{{.User}}がランチに行きました*\n{{if .Text}}「{{.Text}}」{{else}}何食べるんでしょうね？{{end}}",
+		Description:  "ランチ中の状態にします。指定した時間（デフォルトは1時間）が過ぎたら自動で解除します",
+	},
+	{
+		Name:         "meeting",
+		Type:         "会議",
+		Emoji:        ":calendar:",
+		Duration:     time.Hour,
+		Away:         "会議に出ています",
+		Announcement: ":calendar: *{{.User}}が会議に入りました*{{if .Until}}（{{.Until}}まで）{{end}}{{if .Text}}\n「{{.Text}}」{{end}}",
+	},
+	{
+		Name:         "commute",
+		Type:         "移動",
+		Emoji:        ":train:",
+		Away:         "移動中です",
+		Announcement: ":train: *{{.User}}が移動中です*{{if .Text}}\n「{{.Text}}」{{end}}",
+	},
+	{
+		Name:         "nakanuke",
+		Type:         "中抜け",
+		Emoji:        ":house:",
+		Break:        true,
+		Away:         "中抜けしています",
+		Announcement: ":house: *{{.User}}が中抜けしました*{{if .Until}}（{{.Until}}に戻ります）{{end}}{{if .Text}}\n「{{.Text}}」{{end}}",
+	},
+	{
+		Name:         "outing",
+		Type:         "外勤",
+		Emoji:        ":office:",
+		Away:         "外出先で仕事をしています",
+		Announcement: ":office: *{{.User}}が外出しました*{{if .Text}}\n「{{.Text}}」{{end}}",
+	},
+}
+
+// reservedTypes are the attendance types that are not statuses
+var reservedTypes = map[string]bool{"出勤": true, "退勤": true, "復帰": true, "取消": true}
+
+// namePattern keeps names usable as slash commands
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,30}$`)
+
+// Catalog is the list of statuses, in the order of the built-in entries followed by the added ones
+type Catalog struct {
+	entries []Entry
+	byName  map[string]int
+	byType  map[string]int
+}
+
+var current = mustBuild(nil)
+
+// Current returns the catalog loaded by LoadFromEnv, or the built-in one before that
+func Current() *Catalog {
+	return current
+}
+
+// LoadFromEnv reads the JSON file of AFK_STATUS_CATALOG, if set, and makes it the current catalog.
+// Its entries are added to the built-in ones; an entry with a built-in name replaces that entry
+// but keeps its type.
+func LoadFromEnv() error {
+	path := os.Getenv(fileEnv)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", fileEnv, err)
+	}
+	var added []jsonEntry
+	if err := json.Unmarshal(data, &added); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	c, err := build(added)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	current = c
+	return nil
+}
+
+// jsonEntry is an Entry as written in the catalog file, with a duration such as "1h30m"
+type jsonEntry struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Emoji        string `json:"emoji"`
+	Duration     string `json:"duration"`
+	Break        bool   `json:"break"`
+	Away         string `json:"away"`
+	Announcement string `json:"announcement"`
+	Description  string `json:"description"`
+}
+
+func mustBuild(added []jsonEntry) *Catalog {
+	c, err := build(added)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func build(added []jsonEntry) (*Catalog, error) {
+	c := &Catalog{byName: map[string]int{}, byType: map[string]int{}}
+	c.entries = append(c.entries, builtin...)
+	for i, e := range c.entries {
+		c.byName[e.Name] = i
+	}
+
+	defined := map[string]bool{}
+	for _, j := range added {
+		if defined[j.Name] {
+			return nil, fmt.Errorf("status %q is defined twice", j.Name)
+		}
+		defined[j.Name] = true
+		e := Entry{
+			Name:         j.Name,
+			Type:         j.Type,
+			Emoji:        j.Emoji,
+			Break:        j.Break,
+			Away:         j.Away,
+			Announcement: j.Announcement,
+			Description:  j.Description,
+		}
+		if j.Duration != "" {
+			d, err := time.ParseDuration(j.Duration)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("status %q: invalid duration %q", j.Name, j.Duration)
+			}
+			e.Duration = d
+		}
+		if i, ok := c.byName[e.Name]; ok {
+			if e.Type != "" && e.Type != builtin[i].Type {
+				return nil, fmt.Errorf("status %q: the type of a built-in status can't be changed from %q", e.Name, builtin[i].Type)
+			}
+			e.Type = builtin[i].Type
+			c.entries[i] = e
+			continue
+		}
+		c.byName[e.Name] = len(c.entries)
+		c.entries = append(c.entries, e)
+	}
+
+	for i := range c.entries {
+		e := &c.entries[i]
+		if !namePattern.MatchString(e.Name) {
+			return nil, fmt.Errorf("status %q: the name must be lowercase letters, digits, - or _", e.Name)
+		}
+		if e.Type == "" || reservedTypes[e.Type] {
+			return nil, fmt.Errorf("status %q: invalid type %q", e.Name, e.Type)
+		}
+		if other, ok := c.byType[e.Type]; ok {
+			return nil, fmt.Errorf("statuses %q and %q have the same type %q", c.entries[other].Name, e.Name, e.Type)
+		}
+		c.byType[e.Type] = i
+		if e.Away == "" {
+			e.Away = e.Type + "中です"
+		}
+		if e.Announcement == "" {
+			e.Announcement = defaultAnnouncement
+		}
+		tmpl, err := template.New(e.Name).Parse(e.Announcement)
+		if err != nil {
+			return nil, fmt.Errorf("status %q: invalid announcement: %w", e.Name, err)
+		}
+		e.announcement = tmpl
+	}
+	return c, nil
+}
+
+// Entries returns every status in catalog order
+func (c *Catalog) Entries() []Entry {
+	return append([]Entry(nil), c.entries...)
+}
+
+// Names returns the names of every status in catalog order
+func (c *Catalog) Names() []string {
+	names := make([]string, len(c.entries))
+	for i, e := range c.entries {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// Get returns the status named name
+func (c *Catalog) Get(name string) (Entry, bool) {
+	i, ok := c.byName[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return c.entries[i], true
+}
+
+// Lookup returns the status whose name or type is word
+func (c *Catalog) Lookup(word string) (Entry, bool) {
+	if e, ok := c.Get(word); ok {
+		return e, true
+	}
+	return c.ByType(word)
+}
+
+// ByType returns the status recorded with an attendance type
+func (c *Catalog) ByType(recordType string) (Entry, bool) {
+	i, ok := c.byType[recordType]
+	if !ok {
+		return Entry{}, false
+	}
+	return c.entries[i], true
+}
+
+// Command returns the slash command of the status, e.g. "/meeting"
+func (e Entry) Command() string {
+	return "/" + e.Name
+}
+
+// AutoResponse returns the message sent on behalf of user when they are mentioned
+func (e Entry) AutoResponse(user, text string) string {
+	if text != "" {
+		return fmt.Sprintf("%s は%s。「%s」", user, e.Away, text)
+	}
+	return fmt.Sprintf("%s は%s。反応が遅れるかもしれません。", user, e.Away)
+}
+
+// Announce renders the channel post of the status. until is zero when the status has no end.
+func (e Entry) Announce(user, text string, until time.Time) (string, error) {
+	data := AnnouncementData{User: user, Text: text, Emoji: e.Emoji, Type: e.Type}
+	if !until.IsZero() {
+		data.Until = until.Format("15:04")
+	}
+	var b bytes.Buffer
+	if err := e.announcement.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render the announcement of %s: %w", e.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Help returns the description shown by "/<name> help"
+func (e Entry) Help() string {
+	if e.Description != "" {
+		return e.Description
+	}
+	if e.Duration > 0 {
+		return strings.TrimSpace(fmt.Sprintf("%s %sの状態にします。指定した時間（デフォルトは%s）が過ぎたら自動で解除します", e.Emoji, e.Type, formatDuration(e.Duration)))
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %sの状態にします。時間を指定するとその時間が過ぎたら自動で解除します", e.Emoji, e.Type))
+}
+
+// formatDuration writes 1h30m as 1時間30分
+func formatDuration(d time.Duration) string {
+	h, m := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%d時間%d分", h, m)
+	case h > 0:
+		return fmt.Sprintf("%d時間", h)
+	}
+	return fmt.Sprintf("%d分", m)
+}
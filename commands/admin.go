@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"os"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// isAdmin reports whether the user may operate on other users' records.
+// Users listed in AFK_ADMIN_USERS and Slack workspace admins and owners are admins.
+func isAdmin(client *slack.Client, uid string) (bool, error) {
+	for _, id := range strings.Split(os.Getenv("AFK_ADMIN_USERS"), ",") {
+		if strings.TrimSpace(id) == uid {
+			return true, nil
+		}
+	}
+
+	user, err := client.GetUserInfo(uid)
+	if err != nil {
+		return false, err
+	}
+	return user.IsAdmin || user.IsOwner, nil
+}
@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/catalog"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// recordTypes maps the words accepted by "/afk-admin record add" to attendance types.
+// The statuses of the catalog are accepted by name and by type too.
+var recordTypes = map[string]string{
+	"start":                  spreadsheet.TypeStart,
+	"finish":                 spreadsheet.TypeFinish,
+	"comeback":               spreadsheet.TypeComeback,
+	spreadsheet.TypeStart:    spreadsheet.TypeStart,
+	spreadsheet.TypeFinish:   spreadsheet.TypeFinish,
+	spreadsheet.TypeComeback: spreadsheet.TypeComeback,
+}
+
+// lookupRecordType returns the attendance type of a word of "/afk-admin record add"
+func lookupRecordType(word string) (string, bool) {
+	if t, ok := recordTypes[word]; ok {
+		return t, true
+	}
+	if e, ok := catalog.Current().Lookup(word); ok {
+		return e.Type, true
+	}
+	return "", false
+}
+
+// AfkAdminCommand handles the /afk-admin command.
+// It lets admins fix the status and attendance records of users who cannot do it themselves.
+// Every action is audited.
+type AfkAdminCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+}
+
+func NewAfkAdminCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *AfkAdminCommand {
+	return &AfkAdminCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *AfkAdminCommand) Usage() Usage {
+	return Usage{
+		Command: "/afk-admin",
+		Args:    "<サブコマンド>",
+		Description: "管理者用のコマンドです。\n" +
+			"• `status set @user [afk|lunch|meeting などの状態|finish] [時間|HH:MM] [メッセージ]` - ユーザーの状態を設定する\n" +
+			"• `status clear @user` - ユーザーの状態を解除する\n" +
+			"• `record add @user <start|finish|comeback|afk|lunch などの状態> [日付] [HH:MM] <理由>` - 勤怠記録を追加する（日時の省略時は現在）\n" +
+			"• `record cancel @user <理由>` - ユーザーの直近の勤怠記録を取り消す\n" +
+			"• `stuck` - 自動応答の対象として登録されたままのユーザーを一覧する",
+		Examples: []string{
+			"/afk-admin status set @yamada finish 体調不良のためお休みです",
+			"/afk-admin record add @yamada finish 昨日 18:30 打刻漏れ",
+			"/afk-admin record cancel @yamada 誤操作",
+		},
+	}
+}
+
+func (c *AfkAdminCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	admin, err := isAdmin(c.client, cmd.UserID)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		c.reply(cmd, "このコマンドは管理者だけが使えます。")
+		return nil
+	}
+
+	group, ok := args.NextWord("status", "record", "stuck")
+	if !ok {
+		return usageErrorf("サブコマンドを指定してください")
+	}
+	switch group {
+	case "status":
+		action, ok := args.NextWord("set", "clear")
+		if !ok {
+			return usageErrorf("status の後に set か clear を指定してください")
+		}
+		target, ok := args.NextUser()
+		if !ok {
+			return usageErrorf("対象のユーザーを @user で指定してください")
+		}
+		if action == "set" {
+			return c.setStatus(cmd, args, target)
+		}
+		if err := args.Done(); err != nil {
+			return err
+		}
+		return c.clearStatus(cmd, target)
+	case "record":
+		action, ok := args.NextWord("add", "cancel")
+		if !ok {
+			return usageErrorf("record の後に add か cancel を指定してください")
+		}
+		target, ok := args.NextUser()
+		if !ok {
+			return usageErrorf("対象のユーザーを @user で指定してください")
+		}
+		if c.attendance == nil {
+			c.reply(cmd, "勤怠スプレッドシートが設定されていません。")
+			return nil
+		}
+		if action == "add" {
+			return c.addRecord(cmd, args, target)
+		}
+		return c.cancelRecord(cmd, args, target)
+	default:
+		if err := args.Done(); err != nil {
+			return err
+		}
+		return c.listStuck(cmd)
+	}
+}
+
+func (c *AfkAdminCommand) setStatus(cmd slack.SlashCommand, args *Args, target string) error {
+	kind, ok := args.NextWord(append(catalog.Current().Names(), "finish")...)
+	if !ok {
+		kind = catalog.Afk
+	}
+	now := nowJST()
+	var expire time.Time
+	if kind == "finish" {
+		until, ok := args.NextClock()
+		if !ok {
+			until = Clock{Hour: 9}
+		}
+		expire = until.Next(now)
+	} else {
+		entry, _ := catalog.Current().Get(kind)
+		d, ok := args.NextDuration()
+		if !ok {
+			d = entry.Duration
+		}
+		if d > 0 {
+			expire = now.Add(d)
+		}
+	}
+	text := args.Text()
+
+	name, err := c.userName(target)
+	if err != nil {
+		return err
+	}
+	message := statusMessage(kind, name, text)
+
+	before, _ := c.redisClient.Get(target)
+	// the same presence the user's own /finish or /lunch would have recorded
+	err = c.redisClient.UpdateUserPresence(target, func(p *store.UserPresence) error {
+		p.SetStatus(store.Status(kind), message, now, expire)
+		switch kind {
+		case "finish":
+			p.End = now
+		case catalog.Lunch:
+			p.Lunch = now
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.redisClient.Register(target); err != nil {
+		return err
+	}
+	if err := c.redisClient.Set(target, message); err != nil {
+		return err
+	}
+	detail := message
+	if !expire.IsZero() {
+		if err := c.redisClient.Expire(target, expire.Sub(now)); err != nil {
+			return err
+		}
+		detail += fmt.Sprintf("（%sまで）", expire.Format("01/02 15:04"))
+	}
+
+	c.audit(cmd, "status set", target, before, detail)
+	c.reply(cmd, fmt.Sprintf("<@%s> の状態を設定しました: %s", target, detail))
+	return nil
+}
+
+// statusMessage is the auto-response the user's own command would have set
+func statusMessage(kind, name, text string) string {
+	if entry, ok := catalog.Current().Get(kind); ok {
+		return entry.AutoResponse(name, text)
+	}
+	if text != "" {
+		return fmt.Sprintf("%s は退勤しました。「%s」", name, text)
+	}
+	return fmt.Sprintf("%s は退勤しました。反応が遅れるかもしれません。", name)
+}
+
+func (c *AfkAdminCommand) clearStatus(cmd slack.SlashCommand, target string) error {
+	before, _ := c.redisClient.Get(target)
+	// back to work, as with /comeback
+	err := c.redisClient.UpdateUserPresence(target, func(p *store.UserPresence) error {
+		p.SetStatus(store.StatusBack, "", nowJST(), time.Time{})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.redisClient.Delete(target); err != nil {
+		return err
+	}
+	if err := c.redisClient.Unregister(target); err != nil {
+		return err
+	}
+
+	c.audit(cmd, "status clear", target, before, "")
+	c.reply(cmd, fmt.Sprintf("<@%s> の状態を解除しました。", target))
+	return nil
+}
+
+func (c *AfkAdminCommand) addRecord(cmd slack.SlashCommand, args *Args, target string) error {
+	var recordType string
+	ok := args.next(func(w string) bool {
+		var found bool
+		recordType, found = lookupRecordType(w)
+		return found
+	})
+	if !ok {
+		return usageErrorf("記録の種別を start, finish, comeback か状態（%s）で指定してください", strings.Join(catalog.Current().Names(), ", "))
+	}
+
+	at := nowJST()
+	if date, ok := args.NextDate(); ok {
+		at = time.Date(date.Year(), date.Month(), date.Day(), at.Hour(), at.Minute(), at.Second(), 0, at.Location())
+	}
+	if clock, ok := args.NextClock(); ok {
+		at = clock.On(at)
+	}
+	if at.After(nowJST()) {
+		return usageErrorf("未来の日時は指定できません: %s", at.Format("2006-01-02 15:04"))
+	}
+	reason := args.Text()
+	if reason == "" {
+		return usageErrorf("理由を書いてください")
+	}
+
+	message := fmt.Sprintf("%s（管理者 %s による入力）", reason, cmd.UserName)
+	rowNum, err := c.attendance.AppendRecordAt(context.Background(), target, recordType, message, recordID(cmd), at)
+	if err != nil {
+		slog.Error("勤怠記録の代理追加失敗", slog.Any("error", err))
+		c.reply(cmd, "記録の追加に失敗しました: "+err.Error())
+		return nil
+	}
+
+	detail := fmt.Sprintf("%s %s 理由: %s", recordType, at.Format("2006-01-02 15:04"), reason)
+	c.audit(cmd, "record add", target, "", fmt.Sprintf("%s（行%d）", detail, rowNum))
+	c.reply(cmd, fmt.Sprintf("<@%s> の記録を追加しました: %s", target, detail))
+	return nil
+}
+
+func (c *AfkAdminCommand) cancelRecord(cmd slack.SlashCommand, args *Args, target string) error {
+	reason := args.Text()
+	if reason == "" {
+		return usageErrorf("理由を書いてください")
+	}
+
+	cancelled, origType, origMsg, err := c.attendance.CancelLastRecord(context.Background(), target, fmt.Sprintf("%s（管理者 %s による取消）", reason, cmd.UserName), recordID(cmd))
+	if err != nil {
+		slog.Error("勤怠記録の代理取消失敗", slog.Any("error", err))
+		c.reply(cmd, "取消に失敗しました: "+err.Error())
+		return nil
+	}
+	if !cancelled {
+		c.reply(cmd, fmt.Sprintf("<@%s> には取消できる記録がありません。", target))
+		return nil
+	}
+
+	detail := fmt.Sprintf("%s: %s 理由: %s", origType, origMsg, reason)
+	c.audit(cmd, "record cancel", target, strings.TrimSpace(origType+" "+origMsg), "理由: "+reason)
+	c.reply(cmd, fmt.Sprintf("<@%s> の直近の記録（%s）を取消しました。", target, detail))
+	return nil
+}
+
+func (c *AfkAdminCommand) listStuck(cmd slack.SlashCommand) error {
+	registered, err := c.redisClient.RegisteredUsers()
+	if err != nil {
+		return err
+	}
+	if len(registered) == 0 {
+		c.reply(cmd, "自動応答の対象として登録されているユーザーはいません。")
+		return nil
+	}
+
+	lines := []string{fmt.Sprintf("自動応答の対象として登録されているユーザー（%d人）:", len(registered))}
+	for _, uid := range registered {
+		ttl, exists, err := c.redisClient.TTL(uid)
+		if err != nil {
+			return err
+		}
+		var state string
+		switch {
+		case !exists:
+			state = "自動応答は期限切れ（一覧にだけ残っています）"
+		case ttl < 0:
+			state = "期限なし"
+		default:
+			state = "残り " + ttl.Truncate(time.Minute).String()
+		}
+		message, _ := c.redisClient.Get(uid)
+		line := fmt.Sprintf("• <@%s> - %s", uid, state)
+		if message != "" {
+			line += "「" + message + "」"
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "解除するには `/afk-admin status clear @user` を実行してください。")
+
+	c.audit(cmd, "stuck", "", "", fmt.Sprintf("%d users", len(registered)))
+	c.reply(cmd, strings.Join(lines, "\n"))
+	return nil
+}
+
+func (c *AfkAdminCommand) userName(uid string) (string, error) {
+	user, err := c.client.GetUserInfo(uid)
+	if err != nil {
+		return "", err
+	}
+	if user.Profile.DisplayName != "" {
+		return user.Profile.DisplayName, nil
+	}
+	if user.RealName != "" {
+		return user.RealName, nil
+	}
+	return user.Name, nil
+}
+
+func (c *AfkAdminCommand) reply(cmd slack.SlashCommand, text string) {
+	if _, err := c.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText(text, false)); err != nil {
+		slog.Error("Failed to post ephemeral message", slog.Any("error", err))
+	}
+}
+
+// audit records an admin action in the audit log and posts it to AFK_AUDIT_CHANNEL when set
+func (c *AfkAdminCommand) audit(cmd slack.SlashCommand, action, target, before, after string) {
+	slog.Info("Admin action",
+		slog.String("actor", cmd.UserID),
+		slog.String("action", action),
+		slog.String("target", target),
+		slog.String("before", before),
+		slog.String("after", after),
+	)
+	c.auditLog.Record(audit.Entry{
+		Actor:  cmd.UserID,
+		Target: target,
+		Action: "admin." + strings.ReplaceAll(action, " ", "."),
+		Source: audit.SourceSlash,
+		Before: before,
+		After:  after,
+	})
+
+	channelID := os.Getenv("AFK_AUDIT_CHANNEL")
+	if channelID == "" {
+		return
+	}
+	text := fmt.Sprintf(":memo: <@%s> が `%s` を実行しました", cmd.UserID, action)
+	if target != "" {
+		text += fmt.Sprintf("（対象: <@%s>）", target)
+	}
+	if before != "" {
+		text += "\n変更前: " + before
+	}
+	if after != "" {
+		text += "\n変更後: " + after
+	}
+	if _, _, err := c.client.PostMessage(channelID, slack.MsgOptionText(text, false)); err != nil {
+		slog.Error("Failed to post audit message", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,525 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlagKind is the type of value a flag takes
+type FlagKind int
+
+const (
+	FlagBool FlagKind = iota
+	FlagString
+	FlagDuration
+	FlagTime
+	FlagDate
+	FlagUser
+	FlagChannel
+)
+
+// Flag declares a --flag accepted by a command
+type Flag struct {
+	Name string
+	Kind FlagKind
+	Help string
+}
+
+// Usage describes a command. It is shown by "/command help" and on malformed input.
+type Usage struct {
+	Command     string // "/lunch"
+	Args        string // "[時間] [メッセージ]"
+	Description string
+	Flags       []Flag
+	Examples    []string
+}
+
+// Line returns the one-line synopsis, e.g. "/lunch [時間] [メッセージ] [--quiet]"
+func (u Usage) Line() string {
+	parts := []string{u.Command}
+	if u.Args != "" {
+		parts = append(parts, u.Args)
+	}
+	for _, f := range u.Flags {
+		if f.Kind == FlagBool {
+			parts = append(parts, "[--"+f.Name+"]")
+		} else {
+			parts = append(parts, fmt.Sprintf("[--%s %s]", f.Name, f.Kind.placeholder()))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Help returns the full help text in mrkdwn
+func (u Usage) Help() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*`%s`*\n%s", u.Line(), u.Description)
+	if len(u.Flags) > 0 {
+		b.WriteString("\n\n*オプション:*")
+		for _, f := range u.Flags {
+			name := "--" + f.Name
+			if f.Kind != FlagBool {
+				name += " " + f.Kind.placeholder()
+			}
+			fmt.Fprintf(&b, "\n• `%s` - %s", name, f.Help)
+		}
+	}
+	if len(u.Examples) > 0 {
+		b.WriteString("\n\n*例:*")
+		for _, e := range u.Examples {
+			fmt.Fprintf(&b, "\n• `%s`", e)
+		}
+	}
+	return b.String()
+}
+
+func (k FlagKind) placeholder() string {
+	switch k {
+	case FlagDuration:
+		return "時間"
+	case FlagTime:
+		return "HH:MM"
+	case FlagDate:
+		return "日付"
+	case FlagUser:
+		return "@user"
+	case FlagChannel:
+		return "#channel"
+	default:
+		return "値"
+	}
+}
+
+// commonFlags are accepted by every command that posts to the channel
+var commonFlags = []Flag{
+	{Name: "quiet", Kind: FlagBool, Help: "チャンネルに投稿しない"},
+	{Name: "channel", Kind: FlagChannel, Help: "指定したチャンネルに投稿する"},
+}
+
+// UsageError is malformed input. The command handler replies with the message and the usage.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return &UsageError{Message: fmt.Sprintf(format, a...)}
+}
+
+// IsUsageError reports whether err is malformed input rather than a failure
+func IsUsageError(err error) (*UsageError, bool) {
+	var ue *UsageError
+	ok := errors.As(err, &ue)
+	return ue, ok
+}
+
+type token struct {
+	text       string
+	start, end int // byte offsets in the original text, end includes trailing spaces
+}
+
+// Args is the parsed text of a slash command.
+// Flags are parsed up front; positional words are consumed in order by the Next* methods
+// and whatever is left is the free text message.
+type Args struct {
+	Help bool
+
+	text  string
+	words []token
+	pos   int // next word to consume
+	flags map[string]interface{}
+}
+
+var (
+	userRefPattern    = regexp.MustCompile(`^<@([UW][A-Z0-9]+)(\|[^>]*)?>$`)
+	channelRefPattern = regexp.MustCompile(`^<#([CG][A-Z0-9]+)(\|[^>]*)?>$`)
+	monthPattern      = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+	clockPattern      = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	jaDurationPattern = regexp.MustCompile(`^(?:(\d+)時間)?(?:(\d+)分)?$`)
+	slashDatePattern  = regexp.MustCompile(`^(?:(\d{4})/)?(\d{1,2})/(\d{1,2})$`)
+)
+
+// ParseArgs splits text into flags and words according to usage.
+// "help" as the first word asks for the usage. "--" ends the flags, so the rest is taken literally.
+// The flags of usage are taken wherever they are. An unknown --word is a usage error before the first
+// word, where it is most likely a mistyped flag, and part of the text after it, as in "/afk fixing the --force push".
+func ParseArgs(text string, usage Usage) (*Args, error) {
+	a := &Args{
+		text:  text,
+		flags: map[string]interface{}{},
+	}
+	tokens := tokenize(text)
+	if len(tokens) > 0 && (tokens[0].text == "help" || tokens[0].text == "--help" || tokens[0].text == "-h") {
+		a.Help = true
+		return a, nil
+	}
+
+	known := map[string]Flag{}
+	for _, f := range usage.Flags {
+		known[f.Name] = f
+	}
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.text == "--" {
+			if i+1 < len(tokens) {
+				// 区切り以降はそのままメッセージとして扱う
+				a.words = append(a.words, token{text: text[tokens[i+1].start:], start: tokens[i+1].start, end: len(text)})
+			}
+			break
+		}
+		if !strings.HasPrefix(t.text, "--") {
+			a.words = append(a.words, t)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(t.text, "--"), "=")
+		f, ok := known[name]
+		if !ok {
+			if len(a.words) > 0 {
+				a.words = append(a.words, t)
+				continue
+			}
+			return nil, usageErrorf("不明なオプションです: --%s", name)
+		}
+		if f.Kind == FlagBool {
+			if hasValue {
+				return nil, usageErrorf("--%s に値は指定できません", name)
+			}
+			a.flags[name] = true
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(tokens) {
+				return nil, usageErrorf("--%s に%sを指定してください", name, f.Kind.placeholder())
+			}
+			i++
+			value = tokens[i].text
+		}
+		v, err := parseValue(f.Kind, value)
+		if err != nil {
+			return nil, usageErrorf("--%s: %s", name, err)
+		}
+		a.flags[name] = v
+	}
+	return a, nil
+}
+
+// tokenize splits on whitespace, remembering where each word is in the original text
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		space := r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '　'
+		switch {
+		case !space && start < 0:
+			start = i
+		case space && start >= 0:
+			tokens = append(tokens, token{text: text[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: text[start:], start: start, end: len(text)})
+	}
+	// 単語を取り除いたときに空白が残らないよう、後続の空白も単語の範囲に含める
+	for i := range tokens {
+		if i+1 < len(tokens) {
+			tokens[i].end = tokens[i+1].start
+		} else {
+			tokens[i].end = len(text)
+		}
+	}
+	return tokens
+}
+
+func parseValue(kind FlagKind, s string) (interface{}, error) {
+	var (
+		v  interface{}
+		ok bool
+	)
+	switch kind {
+	case FlagDuration:
+		v, ok = parseDuration(s)
+	case FlagTime:
+		v, ok = parseClock(s)
+	case FlagDate:
+		v, ok = parseDate(s, nowJST())
+	case FlagUser:
+		v, ok = parseUserRef(s)
+	case FlagChannel:
+		v, ok = parseChannelRef(s)
+	default:
+		v, ok = s, true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%q は%sとして読めません", s, kind.placeholder())
+	}
+	return v, nil
+}
+
+// Bool reports whether a boolean flag was given
+func (a *Args) Bool(name string) bool {
+	v, _ := a.flags[name].(bool)
+	return v
+}
+
+// String returns the value of a string flag
+func (a *Args) String(name string) (string, bool) {
+	v, ok := a.flags[name].(string)
+	return v, ok
+}
+
+// Channel returns the channel ID of a #channel flag
+func (a *Args) Channel(name string) (string, bool) {
+	v, ok := a.flags[name].(channelRef)
+	return string(v), ok
+}
+
+// User returns the user ID of an @user flag
+func (a *Args) User(name string) (string, bool) {
+	v, ok := a.flags[name].(userRef)
+	return string(v), ok
+}
+
+// Duration returns the value of a duration flag
+func (a *Args) Duration(name string) (time.Duration, bool) {
+	v, ok := a.flags[name].(time.Duration)
+	return v, ok
+}
+
+// Clock returns the value of a HH:MM flag
+func (a *Args) Clock(name string) (Clock, bool) {
+	v, ok := a.flags[name].(Clock)
+	return v, ok
+}
+
+// Date returns the value of a date flag
+func (a *Args) Date(name string) (time.Time, bool) {
+	v, ok := a.flags[name].(time.Time)
+	return v, ok
+}
+
+// peek returns the next positional word
+func (a *Args) peek() (string, bool) {
+	if a.pos >= len(a.words) {
+		return "", false
+	}
+	return a.words[a.pos].text, true
+}
+
+// next consumes the next word when parse accepts it
+func (a *Args) next(parse func(string) bool) bool {
+	w, ok := a.peek()
+	if !ok || !parse(w) {
+		return false
+	}
+	a.pos++
+	return true
+}
+
+// NextWord consumes the next word when it is one of choices
+func (a *Args) NextWord(choices ...string) (string, bool) {
+	var v string
+	ok := a.next(func(w string) bool {
+		for _, c := range choices {
+			if w == c {
+				v = w
+				return true
+			}
+		}
+		return false
+	})
+	return v, ok
+}
+
+// NextInt consumes the next word when it is a non-negative integer
+func (a *Args) NextInt() (int, bool) {
+	var v int
+	ok := a.next(func(w string) bool {
+		n, err := strconv.Atoi(w)
+		v = n
+		return err == nil && n >= 0
+	})
+	return v, ok
+}
+
+// NextDuration consumes the next word when it is a duration such as "30m", "1h30m", "30分" or "1時間30分"
+func (a *Args) NextDuration() (time.Duration, bool) {
+	var v time.Duration
+	ok := a.next(func(w string) (ok bool) { v, ok = parseDuration(w); return })
+	return v, ok
+}
+
+// NextClock consumes the next word when it is a time of day such as "9:00"
+func (a *Args) NextClock() (Clock, bool) {
+	var v Clock
+	ok := a.next(func(w string) (ok bool) { v, ok = parseClock(w); return })
+	return v, ok
+}
+
+// NextDate consumes the next word when it is a date such as "2026-10-18", "10/18", "今日" or "昨日"
+func (a *Args) NextDate() (time.Time, bool) {
+	var v time.Time
+	ok := a.next(func(w string) (ok bool) { v, ok = parseDate(w, nowJST()); return })
+	return v, ok
+}
+
+// NextMonth consumes the next word when it is a month such as "2026-10"
+func (a *Args) NextMonth() (string, bool) {
+	var v string
+	ok := a.next(func(w string) bool { v = w; return parseMonth(w) })
+	return v, ok
+}
+
+// NextUser consumes the next word when it is an @user reference and returns the user ID
+func (a *Args) NextUser() (string, bool) {
+	var v userRef
+	ok := a.next(func(w string) (ok bool) { v, ok = parseUserRef(w); return })
+	return string(v), ok
+}
+
+// NextChannel consumes the next word when it is a #channel reference and returns the channel ID
+func (a *Args) NextChannel() (string, bool) {
+	var v channelRef
+	ok := a.next(func(w string) (ok bool) { v, ok = parseChannelRef(w); return })
+	return string(v), ok
+}
+
+// Text returns the words not consumed yet as written, for free text messages
+func (a *Args) Text() string {
+	var b strings.Builder
+	for i := a.pos; i < len(a.words); i++ {
+		w := a.words[i]
+		b.WriteString(a.text[w.start:w.end])
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Done fails when words are left over, for commands that take no free text
+func (a *Args) Done() error {
+	if w, ok := a.peek(); ok {
+		return usageErrorf("余分な引数があります: %s", w)
+	}
+	return nil
+}
+
+type (
+	userRef    string
+	channelRef string
+)
+
+// Clock is a time of day
+type Clock struct {
+	Hour, Minute int
+}
+
+// On returns the clock time on the day of t
+func (c Clock) On(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), c.Hour, c.Minute, 0, 0, t.Location())
+}
+
+// Next returns the first time at the clock time after now
+func (c Clock) Next(now time.Time) time.Time {
+	t := c.On(now)
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+func (c Clock) String() string {
+	return fmt.Sprintf("%d:%02d", c.Hour, c.Minute)
+}
+
+func parseDuration(s string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+	m := jaDurationPattern.FindStringSubmatch(s)
+	if m == nil || (m[1] == "" && m[2] == "") {
+		return 0, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	d := time.Duration(h)*time.Hour + time.Duration(min)*time.Minute
+	return d, d > 0
+}
+
+func parseClock(s string) (Clock, bool) {
+	m := clockPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Clock{}, false
+	}
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	if h > 23 || min > 59 {
+		return Clock{}, false
+	}
+	return Clock{Hour: h, Minute: min}, true
+}
+
+// parseDate reads a date in the location of now. A date without a year is in the year of now.
+func parseDate(s string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch s {
+	case "today", "今日":
+		return today, true
+	case "yesterday", "昨日":
+		return today.AddDate(0, 0, -1), true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, true
+	}
+	m := slashDatePattern.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year := now.Year()
+	if m[1] != "" {
+		year, _ = strconv.Atoi(m[1])
+	}
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+	if t.Month() != time.Month(month) || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func parseMonth(s string) bool {
+	m := monthPattern.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	month, _ := strconv.Atoi(m[2])
+	return month >= 1 && month <= 12
+}
+
+func parseUserRef(s string) (userRef, bool) {
+	m := userRefPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	return userRef(m[1]), true
+}
+
+func parseChannelRef(s string) (channelRef, bool) {
+	m := channelRefPattern.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	return channelRef(m[1]), true
+}
+
+func nowJST() time.Time {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	return time.Now().In(jst)
+}
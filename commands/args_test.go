@@ -0,0 +1,294 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testUsage = Usage{
+	Command: "/test",
+	Flags: append([]Flag{
+		{Name: "type", Kind: FlagString},
+		{Name: "for", Kind: FlagDuration},
+		{Name: "at", Kind: FlagTime},
+		{Name: "date", Kind: FlagDate},
+		{Name: "user", Kind: FlagUser},
+	}, commonFlags...),
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		help  bool
+		flags map[string]interface{}
+		words []string
+		rest  string // Text() after consuming nothing
+		err   bool
+	}{
+		{name: "empty", text: "", flags: map[string]interface{}{}},
+		{name: "help", text: "help", help: true},
+		{name: "-h", text: "-h", help: true},
+		{name: "--help", text: "--help me", help: true},
+		{name: "help later is text", text: "please help", flags: map[string]interface{}{}, words: []string{"please", "help"}, rest: "please help"},
+		{
+			name:  "bool and channel",
+			text:  "--quiet --channel <#C0123ABCD|general> 打ち合わせ",
+			flags: map[string]interface{}{"quiet": true, "channel": channelRef("C0123ABCD")},
+			words: []string{"打ち合わせ"},
+			rest:  "打ち合わせ",
+		},
+		{
+			name:  "flag after a word",
+			text:  "1h30m --channel <#C0123ABCD> 駅前",
+			flags: map[string]interface{}{"channel": channelRef("C0123ABCD")},
+			words: []string{"1h30m", "駅前"},
+			rest:  "1h30m 駅前",
+		},
+		{
+			name:  "flag=value",
+			text:  "--type=meeting --for=45分 --at 9:05 --user <@U0123ABCD|yamada>",
+			flags: map[string]interface{}{"type": "meeting", "for": 45 * time.Minute, "at": Clock{Hour: 9, Minute: 5}, "user": userRef("U0123ABCD")},
+		},
+		{
+			name:  "unknown flag in the text",
+			text:  "fixing the --force push",
+			flags: map[string]interface{}{},
+			words: []string{"fixing", "the", "--force", "push"},
+			rest:  "fixing the --force push",
+		},
+		{name: "unknown flag first", text: "--quite 打ち合わせ", err: true},
+		{
+			name:  "double dash",
+			text:  "--quiet -- --channel is literal  text",
+			flags: map[string]interface{}{"quiet": true},
+			words: []string{"--channel is literal  text"},
+			rest:  "--channel is literal  text",
+		},
+		{name: "double dash at the end", text: "--quiet --", flags: map[string]interface{}{"quiet": true}},
+		{name: "bool with value", text: "--quiet=yes", err: true},
+		{name: "missing value", text: "--type", err: true},
+		{name: "bad duration", text: "--for soon", err: true},
+		{name: "bad clock", text: "--at 25:00", err: true},
+		{name: "bad user", text: "--user @yamada", err: true},
+		{name: "bad channel", text: "--channel #general", err: true},
+		{
+			name:  "full-width space",
+			text:  "30分　ランチ\n行ってきます",
+			flags: map[string]interface{}{},
+			words: []string{"30分", "ランチ", "行ってきます"},
+			rest:  "30分　ランチ\n行ってきます",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseArgs(tt.text, testUsage)
+			if tt.err {
+				if _, ok := IsUsageError(err); !ok {
+					t.Fatalf("ParseArgs(%q) error = %v, want a usage error", tt.text, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseArgs(%q): %v", tt.text, err)
+			}
+			if a.Help != tt.help {
+				t.Errorf("Help = %v, want %v", a.Help, tt.help)
+			}
+			if tt.help {
+				return
+			}
+			if !reflect.DeepEqual(a.flags, tt.flags) {
+				t.Errorf("flags = %#v, want %#v", a.flags, tt.flags)
+			}
+			var words []string
+			for _, w := range a.words {
+				words = append(words, w.text)
+			}
+			if !reflect.DeepEqual(words, tt.words) {
+				t.Errorf("words = %q, want %q", words, tt.words)
+			}
+			if got := a.Text(); got != tt.rest {
+				t.Errorf("Text() = %q, want %q", got, tt.rest)
+			}
+		})
+	}
+}
+
+func TestArgsNext(t *testing.T) {
+	a, err := ParseArgs("<@U0123ABCD> <#C0456EFGH|random> 2026-10 30分 9:30 3 finish 残り の メッセージ", testUsage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.NextChannel(); ok {
+		t.Error("NextChannel consumed a user")
+	}
+	if uid, ok := a.NextUser(); !ok || uid != "U0123ABCD" {
+		t.Errorf("NextUser = %q, %v", uid, ok)
+	}
+	if ch, ok := a.NextChannel(); !ok || ch != "C0456EFGH" {
+		t.Errorf("NextChannel = %q, %v", ch, ok)
+	}
+	if m, ok := a.NextMonth(); !ok || m != "2026-10" {
+		t.Errorf("NextMonth = %q, %v", m, ok)
+	}
+	if d, ok := a.NextDuration(); !ok || d != 30*time.Minute {
+		t.Errorf("NextDuration = %v, %v", d, ok)
+	}
+	if c, ok := a.NextClock(); !ok || c != (Clock{Hour: 9, Minute: 30}) {
+		t.Errorf("NextClock = %v, %v", c, ok)
+	}
+	if n, ok := a.NextInt(); !ok || n != 3 {
+		t.Errorf("NextInt = %d, %v", n, ok)
+	}
+	if _, ok := a.NextWord("start"); ok {
+		t.Error("NextWord consumed a word not in the choices")
+	}
+	if w, ok := a.NextWord("start", "finish"); !ok || w != "finish" {
+		t.Errorf("NextWord = %q, %v", w, ok)
+	}
+	if err := a.Done(); err == nil {
+		t.Error("Done succeeded with words left")
+	}
+	if got := a.Text(); got != "残り の メッセージ" {
+		t.Errorf("Text() = %q", got)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"30m", 30 * time.Minute, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"30分", 30 * time.Minute, true},
+		{"1時間", time.Hour, true},
+		{"1時間30分", 90 * time.Minute, true},
+		{"0m", 0, false},
+		{"-5m", 0, false},
+		{"0分", 0, false},
+		{"時間", 0, false},
+		{"30", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDuration(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Clock
+		ok   bool
+	}{
+		{"9:00", Clock{9, 0}, true},
+		{"09:05", Clock{9, 5}, true},
+		{"23:59", Clock{23, 59}, true},
+		{"24:00", Clock{}, false},
+		{"9:60", Clock{}, false},
+		{"9:5", Clock{}, false},
+		{"900", Clock{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseClock(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestClockNext(t *testing.T) {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Date(2026, 10, 31, 18, 0, 0, 0, jst)
+	if got, want := (Clock{Hour: 9}).Next(now), time.Date(2026, 11, 1, 9, 0, 0, 0, jst); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+	if got, want := (Clock{Hour: 18, Minute: 30}).Next(now), time.Date(2026, 10, 31, 18, 30, 0, 0, jst); !got.Equal(want) {
+		t.Errorf("Next = %v, want %v", got, want)
+	}
+	if got, want := (Clock{Hour: 18}).Next(now), time.Date(2026, 11, 1, 18, 0, 0, 0, jst); !got.Equal(want) {
+		t.Errorf("Next at the same time = %v, want %v", got, want)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Date(2026, 3, 1, 0, 30, 0, 0, jst)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, jst) }
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"今日", day(2026, 3, 1), true},
+		{"today", day(2026, 3, 1), true},
+		{"昨日", day(2026, 2, 28), true},
+		{"yesterday", day(2026, 2, 28), true},
+		{"2026-10-18", day(2026, 10, 18), true},
+		{"10/18", day(2026, 10, 18), true},
+		{"2025/12/31", day(2025, 12, 31), true},
+		{"2/29", time.Time{}, false},
+		{"2028/2/29", day(2028, 2, 29), true},
+		{"2026-13-01", time.Time{}, false},
+		{"13/1", time.Time{}, false},
+		{"明日", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDate(tt.in, now)
+		if !got.Equal(tt.want) || ok != tt.ok {
+			t.Errorf("parseDate(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	for in, want := range map[string]bool{
+		"2026-10": true,
+		"2026-01": true,
+		"2026-12": true,
+		"2026-00": false,
+		"2026-13": false,
+		"2026-1":  false,
+		"10":      false,
+	} {
+		if got := parseMonth(in); got != want {
+			t.Errorf("parseMonth(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestParseRefs(t *testing.T) {
+	users := map[string]userRef{
+		"<@U0123ABCD>":        "U0123ABCD",
+		"<@W0123ABCD|yamada>": "W0123ABCD",
+		"<@U0123ABCD|>":       "U0123ABCD",
+		"@yamada":             "",
+		"<@u0123abcd>":        "",
+		"<#C0123ABCD>":        "",
+	}
+	for in, want := range users {
+		got, ok := parseUserRef(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("parseUserRef(%q) = %q, %v", in, got, ok)
+		}
+	}
+	channels := map[string]channelRef{
+		"<#C0123ABCD>":         "C0123ABCD",
+		"<#G0123ABCD|private>": "G0123ABCD",
+		"#general":             "",
+		"<@U0123ABCD>":         "",
+	}
+	for in, want := range channels {
+		got, ok := parseChannelRef(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("parseChannelRef(%q) = %q, %v", in, got, ok)
+		}
+	}
+}
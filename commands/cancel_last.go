@@ -1,10 +1,13 @@
 package commands
 
 import (
-	"log/slog"
+	"context"
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
 	"github.com/slack-go/slack"
-	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"log/slog"
+	"strings"
 )
 
 // CancelLastCommand handles the /cancel_last command
@@ -14,22 +17,41 @@ import (
 
 type CancelLastCommand struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
 }
 
-func NewCancelLastCommand(client *slack.Client, redisClient *store.RedisClient) *CancelLastCommand {
+func NewCancelLastCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *CancelLastCommand {
 	return &CancelLastCommand{
 		client:      client,
 		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *CancelLastCommand) Usage() Usage {
+	return Usage{
+		Command:     "/cancel_last",
+		Description: "直近の勤怠記録を取り消します。続けて実行すると、さらに前の記録を取り消します",
 	}
 }
 
-func (c *CancelLastCommand) Execute(cmd slack.SlashCommand) error {
+func (c *CancelLastCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	if err := args.Done(); err != nil {
+		return err
+	}
 	uid := cmd.UserID
 	channelID := cmd.ChannelID
 
+	if c.attendance == nil {
+		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("勤怠スプレッドシートが設定されていません。", false))
+		return nil
+	}
+
 	// 勤怠記録取消
-	cancelled, origType, origMsg, err := spreadsheet.CancelLastRecord(c.client, uid)
+	cancelled, origType, origMsg, err := c.attendance.CancelLastRecord(context.Background(), uid, "", recordID(cmd))
 	if err != nil {
 		slog.Error("勤怠記録取消失敗", slog.Any("error", err))
 		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("取消に失敗しました: "+err.Error(), false))
@@ -39,6 +61,13 @@ func (c *CancelLastCommand) Execute(cmd slack.SlashCommand) error {
 		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("取消できる記録がありません。", false))
 		return nil
 	}
+	c.auditLog.Record(audit.Entry{
+		Actor:  uid,
+		Target: uid,
+		Action: "attendance.cancel",
+		Source: audit.SourceSlash,
+		Before: strings.TrimSpace(origType + " " + origMsg),
+	})
 	msg := "直近の記録（" + origType + ": " + origMsg + "）を取消しました。"
 	_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText(msg, false))
 	return nil
@@ -5,7 +5,9 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/pyama86/slack-afk/go/audit"
 	"github.com/pyama86/slack-afk/go/presentation/blocks"
 	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
@@ -15,53 +17,78 @@ import (
 // ComebackCommand handles the /comeback command
 type ComebackCommand struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
 }
 
 // NewComebackCommand creates a new ComebackCommand
-func NewComebackCommand(client *slack.Client, redisClient *store.RedisClient) *ComebackCommand {
+func NewComebackCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *ComebackCommand {
 	return &ComebackCommand{
 		client:      client,
 		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *ComebackCommand) Usage() Usage {
+	return Usage{
+		Command:     "/comeback",
+		Description: "離席状態を解除し、いない間に飛んできたメンションを表示します",
+		Flags:       commonFlags,
 	}
 }
 
 // Execute handles the /comeback command
-func (c *ComebackCommand) Execute(cmd slack.SlashCommand) error {
+func (c *ComebackCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	if err := args.Done(); err != nil {
+		return err
+	}
 	uid := cmd.UserID
 	userName := cmd.UserName
 	channelID := cmd.ChannelID
 
-	// Get user presence
-	userPresence, err := c.redisClient.GetUserPresence(uid)
-	if err != nil {
-		slog.Error("Failed to get user presence", slog.Any("error", err))
-		return err
-	}
-
 	// Post message to channel
-	_, _, err = c.client.PostMessage(channelID, slack.MsgOptionBlocks(blocks.ComebackBlocks(userName)...))
-	if err != nil {
-		slog.Error("Failed to post message", slog.Any("error", err))
-		return err
+	if announce := announceChannel(cmd, args); announce != "" {
+		_, _, err := c.client.PostMessage(announce, slack.MsgOptionBlocks(blocks.ComebackBlocks(userName)...))
+		if err != nil {
+			slog.Error("Failed to post message", slog.Any("error", err))
+			return err
+		}
 	}
 
 	// Remove user from Redis
+	before, _ := c.redisClient.Get(uid)
 	if err := c.redisClient.Delete(uid); err != nil {
 		slog.Error("Failed to delete user from Redis", slog.Any("error", err))
 		return err
 	}
 
 	// Remove user from registered list
-	if err := c.redisClient.RemoveFromList("registered", uid); err != nil {
+	if err := c.redisClient.Unregister(uid); err != nil {
 		slog.Error("Failed to remove user from registered list", slog.Any("error", err))
 		return err
 	}
+	auditPresence(c.auditLog, uid, "presence.comeback", before, "")
 
-	// Check if there are any mentions
-	var mentionHistory []interface{}
-	if history, ok := userPresence["mention_history"].([]interface{}); ok {
-		mentionHistory = history
+	// Take the mentions received while away, now that no more are recorded
+	mentionHistory, err := c.redisClient.TakeMentions(uid)
+	if err != nil {
+		slog.Error("Failed to get mention history", slog.Any("error", err))
+		return err
+	}
+	now := nowJST()
+	err = c.redisClient.UpdateUserPresence(uid, func(p *store.UserPresence) error {
+		p.Status = store.StatusBack
+		p.Message = ""
+		p.Since = now
+		p.ReturnAt = time.Time{}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to set user presence", slog.Any("error", err))
+		return err
 	}
 
 	// Prepare response message
@@ -76,23 +103,13 @@ func (c *ComebackCommand) Execute(cmd slack.SlashCommand) error {
 			slackDomain = "slack.com"
 		}
 
-		for _, mention := range mentionHistory {
-			if m, ok := mention.(map[string]interface{}); ok {
-				user, _ := m["user"].(string)
-				channel, _ := m["channel"].(string)
-				text, _ := m["text"].(string)
-				eventTS, _ := m["event_ts"].(string)
-
-				// Format timestamp for link
-				linkTS := eventTS
-				if linkTS != "" {
-					linkTS = strings.ReplaceAll(linkTS, ".", "")
-				}
-
-				mentionText := fmt.Sprintf("<@%s>: <https://%s/archives/%s/p%s|Link>\n内容: %s\n",
-					user, slackDomain, channel, linkTS, text)
-				responseMessage += mentionText
-			}
+		for _, m := range mentionHistory {
+			// Format timestamp for link
+			linkTS := strings.ReplaceAll(m.EventTS, ".", "")
+
+			mentionText := fmt.Sprintf("<@%s>: <https://%s/archives/%s/p%s|Link>\n内容: %s\n",
+				m.User, slackDomain, m.Channel, linkTS, m.Text)
+			responseMessage += mentionText
 		}
 	}
 
@@ -104,12 +121,7 @@ func (c *ComebackCommand) Execute(cmd slack.SlashCommand) error {
 	}
 
 	// 勤怠記録（エラーはログのみ）
-	go func() {
-		_,err := spreadsheet.AppendAttendanceRecord(c.client, uid, spreadsheet.TypeComeback, "")
-		if err != nil {
-			slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
-		}
-	}()
+	recordAttendance(c.attendance, c.auditLog, cmd, spreadsheet.TypeComeback, "")
 
 	return nil
 }
@@ -1,10 +1,83 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/slack-go/slack"
 )
 
 // Command is the interface for all slash commands
 type Command interface {
-	Execute(cmd slack.SlashCommand) error
+	// Usage describes the arguments. The command handler parses cmd.Text with it before Execute.
+	Usage() Usage
+	Execute(cmd slack.SlashCommand, args *Args) error
+}
+
+// announceChannel returns the channel a command posts its public message to:
+// the --channel flag, or the channel it was run in. It returns "" with --quiet.
+func announceChannel(cmd slack.SlashCommand, args *Args) string {
+	if args.Bool("quiet") {
+		return ""
+	}
+	if channelID, ok := args.Channel("channel"); ok {
+		return channelID
+	}
+	return cmd.ChannelID
+}
+
+// recordID identifies the attendance row written by one invocation of a command.
+// Slack redelivers a command with the same trigger ID, so the row is written only once.
+func recordID(cmd slack.SlashCommand) string {
+	if cmd.TriggerID == "" {
+		return ""
+	}
+	return "slash:" + cmd.TriggerID
+}
+
+// recordAttendance appends an attendance record in the background. Shutdown waits for the write.
+// Errors are only logged, and nothing is recorded when the spreadsheet is not configured.
+func recordAttendance(attendance *spreadsheet.Client, auditLog *audit.Logger, cmd slack.SlashCommand, recordType, message string) {
+	if attendance == nil {
+		return
+	}
+	uid := cmd.UserID
+	id := recordID(cmd)
+	background.Go("attendance", func() {
+		rowNum, err := attendance.AppendAttendanceRecord(context.Background(), uid, recordType, message, id)
+		if err != nil {
+			slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
+			return
+		}
+		auditAttendance(auditLog, uid, uid, recordType, message, rowNum)
+	})
+}
+
+// auditAttendance records an attendance row written on behalf of target
+func auditAttendance(auditLog *audit.Logger, actor, target, recordType, message string, rowNum int) {
+	auditLog.Record(audit.Entry{
+		Actor:  actor,
+		Target: target,
+		Action: "attendance.append",
+		Source: audit.SourceSlash,
+		After:  strings.TrimSpace(recordType + " " + message),
+		Detail: fmt.Sprintf("row %d", rowNum),
+	})
+}
+
+// auditPresence records a change of the user's own away message by a slash command
+func auditPresence(auditLog *audit.Logger, uid, action, before, after string) {
+	auditLog.Record(audit.Entry{
+		Actor:  uid,
+		Target: uid,
+		Action: action,
+		Source: audit.SourceSlash,
+		Before: before,
+		After:  after,
+	})
 }
@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
+	"github.com/pyama86/slack-afk/go/export"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// ExportCommand handles the /export command
+// /export [YYYY-MM] [@user|all] [csv|xlsx]
+// 指定月の勤怠（取消反映済み・実働時間計算済み）をファイルにしてDMにアップロードする
+// 自分以外を指定できるのは管理者だけ
+type ExportCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+}
+
+func NewExportCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *ExportCommand {
+	return &ExportCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *ExportCommand) Usage() Usage {
+	return Usage{
+		Command:     "/export",
+		Args:        "[YYYY-MM] [@user|all] [csv|xlsx]",
+		Description: "勤怠をファイルにしてDMに送ります。自分以外を指定できるのは管理者だけです",
+		Examples:    []string{"/export", "/export 2026-09 xlsx", "/export all"},
+	}
+}
+
+func (c *ExportCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	uid := cmd.UserID
+	channelID := cmd.ChannelID
+
+	if c.attendance == nil {
+		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("勤怠スプレッドシートが設定されていません。", false))
+		return nil
+	}
+
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	month := time.Now().In(jst).Format("2006-01")
+	targets := []string{uid}
+	format := export.FormatCSV
+	// 引数は順不同
+	for {
+		if m, ok := args.NextMonth(); ok {
+			month = m
+		} else if _, ok := args.NextWord("all"); ok {
+			targets = nil
+		} else if u, ok := args.NextUser(); ok {
+			targets = []string{u}
+		} else if f, ok := args.NextWord(string(export.FormatCSV), string(export.FormatXLSX)); ok {
+			format = export.Format(f)
+		} else {
+			break
+		}
+	}
+	if err := args.Done(); err != nil {
+		return err
+	}
+
+	if len(targets) != 1 || targets[0] != uid {
+		admin, err := isAdmin(c.client, uid)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("他のユーザーの勤怠をエクスポートできるのは管理者だけです。", false))
+			return nil
+		}
+	}
+
+	_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText(month+"の勤怠をエクスポートしています…", false))
+	background.Go("export", func() {
+		if err := c.export(context.Background(), uid, month, targets, format); err != nil {
+			slog.Error("勤怠エクスポート失敗", slog.Any("error", err))
+			_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("エクスポートに失敗しました: "+err.Error(), false))
+		}
+	})
+	return nil
+}
+
+func (c *ExportCommand) export(ctx context.Context, uid, month string, targets []string, format export.Format) error {
+	rows, err := export.Collect(ctx, c.attendance, month, targets)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := export.Write(&buf, format, rows); err != nil {
+		return err
+	}
+
+	dm, _, _, err := c.client.OpenConversation(&slack.OpenConversationParameters{Users: []string{uid}})
+	if err != nil {
+		return err
+	}
+	scope := "all"
+	if len(targets) == 1 {
+		scope = targets[0]
+	}
+	filename := fmt.Sprintf("attendance-%s-%s.%s", month, scope, format)
+	_, err = c.client.UploadFile(slack.FileUploadParameters{
+		Reader:         &buf,
+		Filename:       filename,
+		Filetype:       string(format),
+		Title:          filename,
+		InitialComment: fmt.Sprintf("%sの勤怠です（%d件）", month, len(rows)),
+		Channels:       []string{dm.ID},
+	})
+	return err
+}
@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
 	"github.com/pyama86/slack-afk/go/presentation/blocks"
 	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
@@ -15,26 +19,136 @@ import (
 // FinishCommand handles the /finish command
 type FinishCommand struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
 }
 
 // NewFinishCommand creates a new FinishCommand
-func NewFinishCommand(client *slack.Client, redisClient *store.RedisClient) *FinishCommand {
+func NewFinishCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *FinishCommand {
 	return &FinishCommand{
 		client:      client,
 		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
 	}
 }
 
-// Execute handles the /finish command
-func (c *FinishCommand) Execute(cmd slack.SlashCommand) error {
-	uid := cmd.UserID
-	text := cmd.Text
-	userName := cmd.UserName
-	channelID := cmd.ChannelID
+func (c *FinishCommand) Usage() Usage {
+	return Usage{
+		Command:     "/finish",
+		Args:        "[HH:MM] [メッセージ]",
+		Description: "退勤状態にします。指定した時刻（デフォルトは翌朝9:00）まで自動で応答します。`--report` を付けると日報を入力してから退勤します",
+		Flags:       append([]Flag{{Name: "report", Kind: FlagBool, Help: "日報を入力してから退勤する"}}, commonFlags...),
+		Examples:    []string{"/finish", "/finish 10:30 明日は通院してから出社します", "/finish --report"},
+	}
+}
+
+// finishRequest is a /finish to carry out, right away or when the daily report modal is submitted
+type finishRequest struct {
+	UserID    string `json:"user_id"`
+	UserName  string `json:"user_name"`
+	ChannelID string `json:"channel_id"`         // where /finish was run, for the reply
+	Announce  string `json:"announce,omitempty"` // empty with --quiet
+	Until     *Clock `json:"until,omitempty"`
+	Text      string `json:"text,omitempty"`
+	RecordID  string `json:"record_id,omitempty"`
+}
+
+// dailyReport is the answers of the daily report modal
+type dailyReport struct {
+	Done     string
+	Blockers string
+	Tomorrow string
+}
+
+// text writes the report into one cell of the 退勤 row
+func (r dailyReport) text() string {
+	var parts []string
+	for _, s := range []struct{ title, text string }{
+		{"今日やったこと", r.Done},
+		{"困っていること・課題", r.Blockers},
+		{"明日の予定", r.Tomorrow},
+	} {
+		if s.text != "" {
+			parts = append(parts, "【"+s.title+"】\n"+s.text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// reportChannel returns where a daily report is posted: AFK_REPORT_CHANNEL, or the announcement channel
+func reportChannel(req finishRequest) string {
+	if channelID := os.Getenv("AFK_REPORT_CHANNEL"); channelID != "" {
+		return channelID
+	}
+	return req.Announce
+}
+
+// Execute handles the /finish command. With --report it only opens the daily report modal,
+// and finishes when the modal is submitted.
+func (c *FinishCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	req := finishRequest{
+		UserID:    cmd.UserID,
+		UserName:  cmd.UserName,
+		ChannelID: cmd.ChannelID,
+		RecordID:  recordID(cmd),
+	}
+	if until, ok := args.NextClock(); ok {
+		req.Until = &until
+	}
+	req.Text = args.Text()
+	req.Announce = announceChannel(cmd, args)
+
+	if !args.Bool("report") {
+		return c.finish(req, nil)
+	}
+	metadata, err := encodeMetadata(req)
+	if err != nil {
+		return err
+	}
+	if _, err := c.client.OpenView(cmd.TriggerID, blocks.DailyReportModal(metadata)); err != nil {
+		slog.Error("Failed to open view", slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// CallbackID returns the callback ID of the daily report modal
+func (c *FinishCommand) CallbackID() string {
+	return blocks.FinishReportCallbackID
+}
+
+// HandleViewSubmission finishes with the submitted daily report
+func (c *FinishCommand) HandleViewSubmission(callback slack.InteractionCallback) error {
+	var req finishRequest
+	if err := decodeMetadata(callback, &req); err != nil {
+		return err
+	}
+	if req.UserID != callback.User.ID {
+		return fmt.Errorf("daily report of %s submitted by %s", req.UserID, callback.User.ID)
+	}
+	report := dailyReport{
+		Done:     viewValue(callback, blocks.ReportDoneBlock),
+		Blockers: viewValue(callback, blocks.ReportBlockersBlock),
+		Tomorrow: viewValue(callback, blocks.ReportTomorrowBlock),
+	}
+	if err := c.finish(req, &report); err != nil {
+		_, _ = c.client.PostEphemeral(req.ChannelID, req.UserID, slack.MsgOptionText("Failed to execute command: "+err.Error(), false))
+		return err
+	}
+	return nil
+}
+
+// finish sets the finished status, announces it and records the 退勤 row. report is nil without --report.
+func (c *FinishCommand) finish(req finishRequest, report *dailyReport) error {
+	uid := req.UserID
+	text := req.Text
+	userName := req.UserName
+	channelID := req.ChannelID
 
 	// Add user to registered list
-	if err := c.redisClient.AddToList("registered", uid); err != nil {
+	if err := c.redisClient.Register(uid); err != nil {
 		slog.Error("Failed to add user to registered list", slog.Any("error", err))
 		return err
 	}
@@ -48,40 +162,59 @@ func (c *FinishCommand) Execute(cmd slack.SlashCommand) error {
 	}
 
 	// Save to Redis with expiration until tomorrow morning
+	before, _ := c.redisClient.Get(uid)
 	if err := c.redisClient.Set(uid, message); err != nil {
 		slog.Error("Failed to set message", slog.Any("error", err))
 		return err
 	}
 
-	// Calculate expiration time (until 9:00 AM tomorrow)
+	// Calculate expiration time (until 9:00 AM tomorrow, or the given time)
 	jst, _ := time.LoadLocation("Asia/Tokyo")
 	now := time.Now().In(jst)
 	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 9, 0, 0, 0, jst)
+	if req.Until != nil {
+		tomorrow = req.Until.Next(now)
+	}
 	expireDuration := tomorrow.Sub(now)
 	if err := c.redisClient.Expire(uid, expireDuration); err != nil {
 		slog.Error("Failed to set expiration", slog.Any("error", err))
 		return err
 	}
+	auditPresence(c.auditLog, uid, "presence.finish", before, message)
 
-	// Get user presence
-	userPresence, err := c.redisClient.GetUserPresence(uid)
+	// Record the status and today's end time
+	var begin time.Time
+	err := c.redisClient.UpdateUserPresence(uid, func(p *store.UserPresence) error {
+		p.SetStatus(store.StatusFinish, message, now, tomorrow)
+		p.End = now
+		begin = p.Begin
+		return nil
+	})
 	if err != nil {
-		slog.Error("Failed to get user presence", slog.Any("error", err))
-		return err
-	}
-
-	// Set today's end time
-	userPresence["today_end"] = now.Format(time.RFC3339)
-	if err := c.redisClient.SetUserPresence(uid, userPresence); err != nil {
 		slog.Error("Failed to set user presence", slog.Any("error", err))
 		return err
 	}
 
 	// Post message to channel
-	_, _, err = c.client.PostMessage(channelID, slack.MsgOptionBlocks(blocks.FinishBlocks(userName, text)...))
-	if err != nil {
-		slog.Error("Failed to post message", slog.Any("error", err))
-		return err
+	if req.Announce != "" {
+		_, _, err = c.client.PostMessage(req.Announce, slack.MsgOptionBlocks(blocks.FinishBlocks(userName, text)...))
+		if err != nil {
+			slog.Error("Failed to post message", slog.Any("error", err))
+			return err
+		}
+	}
+
+	// Post the daily report
+	var reportText string
+	if report != nil {
+		reportText = report.text()
+		if reportTo := reportChannel(req); reportTo != "" {
+			_, _, err = c.client.PostMessage(reportTo, slack.MsgOptionBlocks(blocks.DailyReportBlocks(userName, report.Done, report.Blockers, report.Tomorrow)...))
+			if err != nil {
+				slog.Error("Failed to post daily report", slog.Any("error", err))
+				return err
+			}
+		}
 	}
 
 	// Get finish message from environment variable or use default
@@ -91,16 +224,16 @@ func (c *FinishCommand) Execute(cmd slack.SlashCommand) error {
 	}
 
 	// Add begin time if available
-	beginTimeStr, ok := userPresence["today_begin"].(string)
-	if ok {
-		beginTime, err := time.Parse(time.RFC3339, beginTimeStr)
-		if err == nil {
-			finishMessage += fmt.Sprintf("\n始業時刻:%s", beginTime.Format("15:04"))
-		}
+	if !begin.IsZero() {
+		finishMessage += fmt.Sprintf("\n始業時刻:%s", begin.In(now.Location()).Format("15:04"))
 	}
 
 	// Add auto-disable time
-	finishMessage += fmt.Sprintf("\n明日の%sに自動で解除します", tomorrow.Format("15:04"))
+	day := "明日"
+	if tomorrow.Day() == now.Day() {
+		day = "今日"
+	}
+	finishMessage += fmt.Sprintf("\n%sの%sに自動で解除します", day, tomorrow.Format("15:04"))
 
 	// Response message
 	_, err = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText(finishMessage, false))
@@ -110,17 +243,21 @@ func (c *FinishCommand) Execute(cmd slack.SlashCommand) error {
 	}
 
 	// 勤怠記録＋実働時間記入（エラーはログのみ）
-	go func() {
-		rowNum, err := spreadsheet.AppendAttendanceRecord(c.client, uid, spreadsheet.TypeFinish, text)
-		if err != nil {
-			slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
-			return
-		}
-		err = spreadsheet.UpdateActualWorkTime(c.client, uid, rowNum)
-		if err != nil {
-			slog.Error("スプレッドシート実働時間記入失敗", slog.Any("error", err))
-		}
-	}()
+	if c.attendance != nil {
+		id := req.RecordID
+		background.Go("attendance", func() {
+			ctx := context.Background()
+			rowNum, at, err := c.attendance.AppendFinishRecord(ctx, uid, text, reportText, id)
+			if err != nil {
+				slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
+				return
+			}
+			auditAttendance(c.auditLog, uid, uid, spreadsheet.TypeFinish, text, rowNum)
+			if err := c.attendance.UpdateActualWorkTime(ctx, uid, at, rowNum); err != nil {
+				slog.Error("スプレッドシート実働時間記入失敗", slog.Any("error", err))
+			}
+		})
+	}
 
 	return nil
 }
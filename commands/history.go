@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// HistoryCommand handles the /history command
+// 自分が操作した、または自分の状態が変わった監査ログを新しい順に表示する
+// 他のユーザーを指定できるのは管理者だけ
+type HistoryCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+}
+
+func NewHistoryCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *HistoryCommand {
+	return &HistoryCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *HistoryCommand) Usage() Usage {
+	return Usage{
+		Command:     "/history",
+		Args:        "[件数] [@user]",
+		Description: fmt.Sprintf("状態の変更・コマンド・自動応答・勤怠記録の履歴を新しい順に表示します（デフォルト%d件、最大%d件）。他のユーザーを指定できるのは管理者だけです", defaultHistoryLimit, maxHistoryLimit),
+		Examples:    []string{"/history", "/history 50"},
+	}
+}
+
+func (c *HistoryCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	uid := cmd.UserID
+	limit := defaultHistoryLimit
+	target := uid
+	for {
+		if n, ok := args.NextInt(); ok {
+			limit = n
+		} else if u, ok := args.NextUser(); ok {
+			target = u
+		} else {
+			break
+		}
+	}
+	if err := args.Done(); err != nil {
+		return err
+	}
+	if limit < 1 || limit > maxHistoryLimit {
+		return usageErrorf("件数は1〜%dで指定してください", maxHistoryLimit)
+	}
+
+	if target != uid {
+		admin, err := isAdmin(c.client, uid)
+		if err != nil {
+			return err
+		}
+		if !admin {
+			_, _ = c.client.PostEphemeral(cmd.ChannelID, uid, slack.MsgOptionText("他のユーザーの履歴を見られるのは管理者だけです。", false))
+			return nil
+		}
+	}
+
+	entries, err := c.auditLog.History(context.Background(), target, limit)
+	if err != nil {
+		slog.Error("監査ログ取得失敗", slog.Any("error", err))
+		return err
+	}
+	if len(entries) == 0 {
+		_, _ = c.client.PostEphemeral(cmd.ChannelID, uid, slack.MsgOptionText("履歴はありません。", false))
+		return nil
+	}
+
+	jst := nowJST().Location()
+	lines := []string{fmt.Sprintf("<@%s> の履歴（新しい順に%d件）:", target, len(entries))}
+	for _, e := range entries {
+		line := fmt.Sprintf("• %s `%s` %s", e.Time.In(jst).Format("01/02 15:04:05"), e.Action, e.Source)
+		if e.Actor != target {
+			line += fmt.Sprintf(" by <@%s>", e.Actor)
+		}
+		if e.Target != "" && e.Target != target {
+			line += fmt.Sprintf(" → <@%s>", e.Target)
+		}
+		if e.Before != "" || e.After != "" {
+			line += fmt.Sprintf(" 「%s」→「%s」", e.Before, e.After)
+		}
+		if e.Detail != "" {
+			line += " " + e.Detail
+		}
+		lines = append(lines, line)
+	}
+	_, err = c.client.PostEphemeral(cmd.ChannelID, uid, slack.MsgOptionText(strings.Join(lines, "\n"), false))
+	return err
+}
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// RebuildSummaryCommand handles the /rebuild_summary command
+// ユーザーごとのシートから集計シートを作り直す
+// 全員分のシートを読み書きするので管理者だけが使える。時間がかかるので、完了したらエフェメラルで知らせる
+type RebuildSummaryCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+}
+
+func NewRebuildSummaryCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *RebuildSummaryCommand {
+	return &RebuildSummaryCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *RebuildSummaryCommand) Usage() Usage {
+	return Usage{
+		Command:     "/rebuild_summary",
+		Description: "ユーザーごとのシートから勤怠の集計シートを作り直します（管理者のみ）",
+	}
+}
+
+func (c *RebuildSummaryCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	if err := args.Done(); err != nil {
+		return err
+	}
+	uid := cmd.UserID
+	channelID := cmd.ChannelID
+
+	if c.attendance == nil {
+		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("勤怠スプレッドシートが設定されていません。", false))
+		return nil
+	}
+	admin, err := isAdmin(c.client, uid)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("集計シートを作り直せるのは管理者だけです。", false))
+		return nil
+	}
+
+	_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("集計シートを作り直しています…", false))
+	background.Go("rebuild_summary", func() {
+		rows, err := c.attendance.RebuildSummary(context.Background())
+		entry := audit.Entry{
+			Actor:  uid,
+			Action: "attendance.rebuild_summary",
+			Source: audit.SourceSlash,
+			Detail: fmt.Sprintf("%d rows", rows),
+		}
+		if err != nil {
+			entry.Detail = "failed: " + err.Error()
+		}
+		c.auditLog.Record(entry)
+		if err != nil {
+			slog.Error("集計シート再作成失敗", slog.Any("error", err))
+			_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText("集計シートの作り直しに失敗しました: "+err.Error(), false))
+			return
+		}
+		_, _ = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText(fmt.Sprintf("集計シートを作り直しました（%d行）。", rows), false))
+	})
+	return nil
+}
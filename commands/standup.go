@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/presentation/blocks"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// PostStandupDigest posts the plans the members of channelID entered with /start today,
+// and names the members who haven't started yet. Members who never used the bot (bots among them) are left out.
+func PostStandupDigest(client *slack.Client, redisClient store.Store, auditLog *audit.Logger, channelID string, now time.Time) error {
+	members, err := channelMembers(client, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to get members of %s: %w", channelID, err)
+	}
+
+	var (
+		plans      []blocks.StandupPlan
+		notStarted []string
+	)
+	for _, uid := range members {
+		p, err := redisClient.GetUserPresence(uid)
+		if err != nil {
+			slog.Error("Failed to get user presence", slog.String("user", uid), slog.Any("error", err))
+			continue
+		}
+		switch {
+		case sameDay(p.Begin, now):
+			plans = append(plans, blocks.StandupPlan{UserID: uid, Location: p.Location, Plan: p.Plan})
+		case !p.Begin.IsZero() || p.Status != "":
+			notStarted = append(notStarted, uid)
+		}
+	}
+
+	date := now.Format("2006-01-02")
+	if _, _, err := client.PostMessage(channelID, slack.MsgOptionBlocks(blocks.StandupDigestBlocks(date, plans, notStarted)...)); err != nil {
+		return fmt.Errorf("failed to post standup digest: %w", err)
+	}
+	auditLog.Record(audit.Entry{
+		Action: "standup.digest",
+		Source: audit.SourceScheduler,
+		Detail: fmt.Sprintf("%s %s: %d started, %d not started", channelID, date, len(plans), len(notStarted)),
+	})
+	return nil
+}
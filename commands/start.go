@@ -1,64 +1,170 @@
 package commands
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
 	"github.com/pyama86/slack-afk/go/presentation/blocks"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
 	"github.com/slack-go/slack"
-	"github.com/pyama86/slack-afk/go/spreadsheet"
 )
 
+// defaultLocations are the work locations /start accepts when AFK_LOCATIONS is not set
+var defaultLocations = []string{"office", "remote", "客先"}
+
+// workLocations returns the work locations /start accepts, from AFK_LOCATIONS (comma separated)
+func workLocations() []string {
+	var locations []string
+	for _, l := range strings.Split(os.Getenv("AFK_LOCATIONS"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			locations = append(locations, l)
+		}
+	}
+	if len(locations) == 0 {
+		return defaultLocations
+	}
+	return locations
+}
+
 // StartCommand handles the /start command
 type StartCommand struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
 }
 
 // NewStartCommand creates a new StartCommand
-func NewStartCommand(client *slack.Client, redisClient *store.RedisClient) *StartCommand {
+func NewStartCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *StartCommand {
 	return &StartCommand{
 		client:      client,
 		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
 	}
 }
 
-// Execute handles the /start command
-func (c *StartCommand) Execute(cmd slack.SlashCommand) error {
-	uid := cmd.UserID
-	userName := cmd.UserName
-	channelID := cmd.ChannelID
+func (c *StartCommand) Usage() Usage {
+	locations := workLocations()
+	return Usage{
+		Command:     "/start",
+		Args:        "[勤務地]",
+		Description: "始業状態にします。勤務地（" + strings.Join(locations, " / ") + "）を指定すると勤怠に記録します。`--plan` を付けると今日の予定を入力してから始業します",
+		Flags:       append([]Flag{{Name: "plan", Kind: FlagBool, Help: "今日の予定を入力してから始業する"}}, commonFlags...),
+		Examples:    []string{"/start", "/start " + locations[0], "/start --plan " + locations[0]},
+	}
+}
 
-	// Remove user from registered list
-	if err := c.redisClient.RemoveFromList("registered", uid); err != nil {
-		slog.Error("Failed to remove user from registered list", slog.Any("error", err))
-		return err
+// startRequest is a /start to carry out, right away or when the morning plan modal is submitted
+type startRequest struct {
+	UserID    string `json:"user_id"`
+	UserName  string `json:"user_name"`
+	ChannelID string `json:"channel_id"`         // where /start was run, for the reply
+	Announce  string `json:"announce,omitempty"` // empty with --quiet
+	Location  string `json:"location,omitempty"`
+	RecordID  string `json:"record_id,omitempty"`
+}
+
+// Execute handles the /start command. With --plan it only opens the morning plan modal,
+// and starts when the modal is submitted.
+func (c *StartCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	locations := workLocations()
+	location, _ := args.NextWord(locations...)
+	if w, ok := args.peek(); ok {
+		return usageErrorf("勤務地は %s のいずれかで指定してください: %s", strings.Join(locations, ", "), w)
+	}
+	req := startRequest{
+		UserID:    cmd.UserID,
+		UserName:  cmd.UserName,
+		ChannelID: cmd.ChannelID,
+		Announce:  announceChannel(cmd, args),
+		Location:  location,
+		RecordID:  recordID(cmd),
 	}
 
-	// Get user presence
-	userPresence, err := c.redisClient.GetUserPresence(uid)
+	if !args.Bool("plan") {
+		return c.start(req, "")
+	}
+	metadata, err := encodeMetadata(req)
 	if err != nil {
-		slog.Error("Failed to get user presence", slog.Any("error", err))
 		return err
 	}
+	if _, err := c.client.OpenView(cmd.TriggerID, blocks.MorningPlanModal(metadata)); err != nil {
+		slog.Error("Failed to open view", slog.Any("error", err))
+		return err
+	}
+	return nil
+}
 
-	// Set today's begin time
-	jst, _ := time.LoadLocation("Asia/Tokyo")
-	now := time.Now().In(jst)
-	userPresence["today_begin"] = now.Format(time.RFC3339)
-	if err := c.redisClient.SetUserPresence(uid, userPresence); err != nil {
-		slog.Error("Failed to set user presence", slog.Any("error", err))
+// CallbackID returns the callback ID of the morning plan modal
+func (c *StartCommand) CallbackID() string {
+	return blocks.StartPlanCallbackID
+}
+
+// HandleViewSubmission starts with the submitted plan
+func (c *StartCommand) HandleViewSubmission(callback slack.InteractionCallback) error {
+	var req startRequest
+	if err := decodeMetadata(callback, &req); err != nil {
+		return err
+	}
+	if req.UserID != callback.User.ID {
+		return fmt.Errorf("morning plan of %s submitted by %s", req.UserID, callback.User.ID)
+	}
+	if err := c.start(req, viewValue(callback, blocks.PlanBlock)); err != nil {
+		_, _ = c.client.PostEphemeral(req.ChannelID, req.UserID, slack.MsgOptionText("Failed to execute command: "+err.Error(), false))
 		return err
 	}
+	return nil
+}
 
-	// Post message to channel
-	_, _, err = c.client.PostMessage(channelID, slack.MsgOptionBlocks(blocks.StartBlocks(userName)...))
+// start sets the working status, announces it and records the 出勤 row. plan is empty without --plan.
+func (c *StartCommand) start(req startRequest, plan string) error {
+	uid := req.UserID
+	userName := req.UserName
+	channelID := req.ChannelID
+	location := req.Location
+
+	// Remove user from registered list
+	before, _ := c.redisClient.Get(uid)
+	if err := c.redisClient.Unregister(uid); err != nil {
+		slog.Error("Failed to remove user from registered list", slog.Any("error", err))
+		return err
+	}
+	auditPresence(c.auditLog, uid, "presence.start", before, location)
+
+	// Set the status, today's begin time, location and plan. Mentions received overnight are kept for /comeback.
+	now := nowJST()
+	err := c.redisClient.UpdateUserPresence(uid, func(p *store.UserPresence) error {
+		p.Status = store.StatusWorking
+		p.Message = ""
+		p.Since = now
+		p.ReturnAt = time.Time{}
+		p.Begin = now
+		p.Location = location
+		p.Plan = plan
+		return nil
+	})
 	if err != nil {
-		slog.Error("Failed to post message", slog.Any("error", err))
+		slog.Error("Failed to set user presence", slog.Any("error", err))
 		return err
 	}
 
+	// Post message to channel
+	if req.Announce != "" {
+		_, _, err = c.client.PostMessage(req.Announce, slack.MsgOptionBlocks(blocks.StartBlocks(userName, location, plan)...))
+		if err != nil {
+			slog.Error("Failed to post message", slog.Any("error", err))
+			return err
+		}
+	}
+
 	// Get start message from environment variable or use default
 	startMessage := os.Getenv("AFK_START_MESSAGE")
 	if startMessage == "" {
@@ -73,12 +179,17 @@ func (c *StartCommand) Execute(cmd slack.SlashCommand) error {
 	}
 
 	// 勤怠記録（エラーはログのみ）
-	go func() {
-		_, err := spreadsheet.AppendAttendanceRecord(c.client, uid, spreadsheet.TypeStart, "")
-		if err != nil {
-			slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
-		}
-	}()
+	if c.attendance != nil {
+		id := req.RecordID
+		background.Go("attendance", func() {
+			rowNum, err := c.attendance.AppendStartRecord(context.Background(), uid, location, plan, id)
+			if err != nil {
+				slog.Error("スプレッドシート勤怠記録失敗", slog.Any("error", err))
+				return
+			}
+			auditAttendance(c.auditLog, uid, uid, spreadsheet.TypeStart, location, rowNum)
+		})
+	}
 
 	return nil
 }
@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/catalog"
+	"github.com/pyama86/slack-afk/go/presentation/blocks"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// StatusCommand sets a status of the catalog: /afk, /lunch and a /<name> command for every other entry.
+// /afk also sets the others with --type.
+type StatusCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+	entry       catalog.Entry
+}
+
+// NewStatusCommand creates the command of a catalog entry
+func NewStatusCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger, entry catalog.Entry) *StatusCommand {
+	return &StatusCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+		entry:       entry,
+	}
+}
+
+func (c *StatusCommand) Usage() Usage {
+	usage := Usage{
+		Command:     c.entry.Command(),
+		Args:        "[時間] [メッセージ]",
+		Description: c.entry.Help(),
+		Flags:       commonFlags,
+		Examples:    []string{c.entry.Command(), c.entry.Command() + " 30分 " + c.entry.Type},
+	}
+	switch c.entry.Name {
+	case catalog.Afk:
+		usage.Description += "\n`--type` で会議・移動などカタログの状態にします（" + strings.Join(catalog.Current().Names(), " / ") + "）"
+		usage.Flags = append([]Flag{{Name: "type", Kind: FlagString, Help: "状態の種類（meeting など）"}}, commonFlags...)
+		usage.Examples = []string{"/afk 打ち合わせ中です", "/afk 30分 郵便局に行ってきます", "/afk --type meeting 45分 定例", "/afk --quiet"}
+	case catalog.Lunch:
+		usage.Examples = []string{"/lunch", "/lunch 45分 駅前の定食屋", "/lunch 1h30m --channel #random"}
+	}
+	return usage
+}
+
+// Execute handles the command
+func (c *StatusCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	entry := c.entry
+	if name, ok := args.String("type"); ok {
+		entry, ok = catalog.Current().Lookup(name)
+		if !ok {
+			return usageErrorf("不明な状態です: %s（%s）", name, strings.Join(catalog.Current().Names(), " / "))
+		}
+	}
+
+	uid := cmd.UserID
+	duration, ok := args.NextDuration()
+	if !ok {
+		duration = entry.Duration
+	}
+	text := args.Text()
+	userName := cmd.UserName
+	channelID := cmd.ChannelID
+
+	// Add user to registered list
+	if err := c.redisClient.Register(uid); err != nil {
+		slog.Error("Failed to add user to registered list", slog.Any("error", err))
+		return err
+	}
+
+	message := entry.AutoResponse(userName, text)
+	now := nowJST()
+	var returnAt time.Time
+	if duration > 0 {
+		returnAt = now.Add(duration)
+	}
+
+	// Record the status and reset user's mention history
+	err := c.redisClient.UpdateUserPresence(uid, func(p *store.UserPresence) error {
+		p.SetStatus(store.Status(entry.Name), message, now, returnAt)
+		if entry.Name == catalog.Lunch {
+			p.Lunch = now
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to set user presence", slog.Any("error", err))
+		return err
+	}
+
+	// Save to Redis, expiring after the duration
+	before, _ := c.redisClient.Get(uid)
+	if err := c.redisClient.Set(uid, message); err != nil {
+		slog.Error("Failed to set message", slog.Any("error", err))
+		return err
+	}
+	response := "行ってらっしゃい!!1"
+	if duration > 0 {
+		if err := c.redisClient.Expire(uid, duration); err != nil {
+			slog.Error("Failed to set expiration", slog.Any("error", err))
+			return err
+		}
+		response += fmt.Sprintf(" %sに自動で解除します", returnAt.Format("15:04"))
+	}
+	auditPresence(c.auditLog, uid, "presence."+entry.Name, before, message)
+
+	// Post message to channel
+	if announce := announceChannel(cmd, args); announce != "" {
+		announcement, err := entry.Announce(userName, text, returnAt)
+		if err != nil {
+			return err
+		}
+		_, _, err = c.client.PostMessage(announce, slack.MsgOptionBlocks(blocks.StatusBlocks(announcement)...))
+		if err != nil {
+			slog.Error("Failed to post message", slog.Any("error", err))
+			return err
+		}
+	}
+
+	// Response message
+	_, err = c.client.PostEphemeral(channelID, uid, slack.MsgOptionText(response, false))
+	if err != nil {
+		slog.Error("Failed to post ephemeral message", slog.Any("error", err))
+		return err
+	}
+
+	// 勤怠記録（エラーはログのみ）
+	recordAttendance(c.attendance, c.auditLog, cmd, entry.Type, text)
+
+	return nil
+}
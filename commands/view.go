@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// ViewHandler is implemented by commands that open a modal. The command handler routes the
+// submission of a view with CallbackID to HandleViewSubmission.
+type ViewHandler interface {
+	CallbackID() string
+	HandleViewSubmission(callback slack.InteractionCallback) error
+}
+
+// encodeMetadata stores what a command needs after the modal in the view's private metadata
+func encodeMetadata(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode view metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeMetadata reads the private metadata written by encodeMetadata
+func decodeMetadata(callback slack.InteractionCallback, v interface{}) error {
+	if err := json.Unmarshal([]byte(callback.View.PrivateMetadata), v); err != nil {
+		return fmt.Errorf("failed to decode view metadata: %w", err)
+	}
+	return nil
+}
+
+// viewValue returns the trimmed text of the input whose block ID and action ID are blockID
+func viewValue(callback slack.InteractionCallback, blockID string) string {
+	return strings.TrimSpace(callback.View.State.Values[blockID][blockID].Value)
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/catalog"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// maxWhoMembers bounds the lines of one /who reply
+const maxWhoMembers = 100
+
+// WhoCommand handles the /who command
+// チャンネルのメンバー（もしくは指定したユーザー）の今日の勤務地と状態を本人にだけ表示する
+type WhoCommand struct {
+	client      *slack.Client
+	redisClient store.Store
+	attendance  *spreadsheet.Client
+	auditLog    *audit.Logger
+}
+
+func NewWhoCommand(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *WhoCommand {
+	return &WhoCommand{
+		client:      client,
+		redisClient: redisClient,
+		attendance:  attendance,
+		auditLog:    auditLog,
+	}
+}
+
+func (c *WhoCommand) Usage() Usage {
+	return Usage{
+		Command:     "/who",
+		Args:        "[@user]",
+		Description: "チャンネルのメンバーの今日の勤務地と状態を表示します。ユーザーを指定するとその人だけを表示します",
+		Examples:    []string{"/who", "/who @yamada"},
+	}
+}
+
+func (c *WhoCommand) Execute(cmd slack.SlashCommand, args *Args) error {
+	target, hasTarget := args.NextUser()
+	if err := args.Done(); err != nil {
+		return err
+	}
+
+	members := []string{target}
+	if !hasTarget {
+		var err error
+		members, err = channelMembers(c.client, cmd.ChannelID)
+		if err != nil {
+			slog.Error("Failed to get channel members", slog.Any("error", err))
+			_, _ = c.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText("チャンネルのメンバーを取得できませんでした。", false))
+			return nil
+		}
+	}
+
+	now := nowJST()
+	var lines []string
+	for _, uid := range members {
+		p, err := c.redisClient.GetUserPresence(uid)
+		if err != nil {
+			slog.Error("Failed to get user presence", slog.String("user", uid), slog.Any("error", err))
+			continue
+		}
+		// 一度も使ったことのないメンバー（ボットなど）は、指定されたとき以外は表示しない
+		if !hasTarget && p.Begin.IsZero() && p.Status == "" {
+			continue
+		}
+		if len(lines) == maxWhoMembers {
+			lines = append(lines, "…ほかにもいます。`/who @user` で個別に確認してください")
+			break
+		}
+		lines = append(lines, "• <@"+uid+"> "+whoLine(p, now))
+	}
+
+	text := "*今日の勤務地と状態*\n" + strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		text = "表示できるメンバーがいません。"
+	}
+	_, err := c.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText(text, false))
+	if err != nil {
+		slog.Error("Failed to post ephemeral message", slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// channelMembers returns every member of the channel
+func channelMembers(client *slack.Client, channelID string) ([]string, error) {
+	var members []string
+	params := &slack.GetUsersInConversationParameters{ChannelID: channelID, Limit: 200}
+	for {
+		ids, cursor, err := client.GetUsersInConversation(params)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ids...)
+		if cursor == "" {
+			return members, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// whoLine describes the work location and status of a user today
+func whoLine(p *store.UserPresence, now time.Time) string {
+	if !sameDay(p.Begin, now) {
+		return "未出勤"
+	}
+	var parts []string
+	if p.Location != "" {
+		parts = append(parts, p.Location)
+	}
+	switch {
+	case p.End.After(p.Begin):
+		parts = append(parts, "退勤（"+p.End.In(now.Location()).Format("15:04")+"）")
+	default:
+		parts = append(parts, whoStatus(p, now))
+	}
+	return strings.Join(parts, " / ")
+}
+
+// whoStatus is the status of a user who has started and not finished
+func whoStatus(p *store.UserPresence, now time.Time) string {
+	e, ok := catalog.Current().Get(string(p.Status))
+	if !ok || (!p.ReturnAt.IsZero() && !p.ReturnAt.After(now)) {
+		return "勤務中"
+	}
+	status := strings.TrimSpace(e.Emoji + " " + e.Type)
+	if !p.ReturnAt.IsZero() {
+		status += fmt.Sprintf("（%sまで）", p.ReturnAt.In(now.Location()).Format("15:04"))
+	}
+	return status
+}
+
+// sameDay reports whether t is on the day of now, in the time zone of now
+func sameDay(t, now time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	y1, m1, d1 := t.In(now.Location()).Date()
+	y2, m2, d2 := now.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/pyama86/slack-afk/go/export"
+)
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	team := fs.String("team", "", "Slack team ID of an OAuth-installed workspace")
+	user := fs.String("user", "all", "comma separated Slack user IDs, or all")
+	month := fs.String("month", currentMonth(), "month to export (YYYY-MM)")
+	formatName := fs.String("format", "csv", "output format (csv or xlsx)")
+	out := fs.String("out", "-", "output file (- for stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	attendance, err := requireAttendanceClient(ctx, *team)
+	if err != nil {
+		return err
+	}
+	rows, err := export.Collect(ctx, attendance, *month, userList(*user))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return export.Write(w, format, rows)
+}
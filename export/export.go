@@ -0,0 +1,150 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/xuri/excelize/v2"
+)
+
+// Format is the output file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+var header = []string{"ユーザーID", "名前", "日付", "時刻", "種別", "メッセージ", "実働時間（h:mm）", "勤務地", "日報"}
+
+// Row is one attendance record of a user
+type Row struct {
+	UserID string
+	Name   string
+	spreadsheet.Record
+}
+
+func (r Row) values() []string {
+	return []string{r.UserID, r.Name, r.Date, r.Time, r.Type, r.Message, r.WorkTime, r.Location, r.Report}
+}
+
+// ParseFormat parses a format name. An empty name means CSV.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (csv or xlsx)", s)
+	}
+}
+
+// Collect reads the valid records of the given month for each user.
+// When userIDs is empty, every user known to the attendance spreadsheet is exported.
+func Collect(ctx context.Context, attendance *spreadsheet.Client, month string, userIDs []string) ([]Row, error) {
+	if len(userIDs) == 0 {
+		users, err := attendance.Users(ctx, month)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = users
+	}
+
+	var rows []Row
+	for _, uid := range userIDs {
+		name, records, err := attendance.MonthRecords(ctx, uid, month)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read records of %s: %w", uid, err)
+		}
+		for _, r := range records {
+			rows = append(rows, Row{UserID: uid, Name: name, Record: r})
+		}
+	}
+	return rows, nil
+}
+
+// Write writes rows to w in the given format
+func Write(w io.Writer, format Format, rows []Row) error {
+	switch format {
+	case FormatXLSX:
+		return writeXLSX(w, rows)
+	default:
+		return writeCSV(w, rows)
+	}
+}
+
+func writeCSV(w io.Writer, rows []Row) error {
+	// Excelで開いても文字化けしないようにBOMを付ける
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, r := range rows {
+		values := r.values()
+		for i, v := range values {
+			values[i] = escapeFormula(v)
+		}
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeFormula prefixes a cell with ' when a spreadsheet would read it as a formula.
+// Messages and reports are user text, so "=HYPERLINK(...)" must stay text when the CSV is opened.
+// XLSX cells are written as strings and need no escaping.
+func escapeFormula(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func writeXLSX(w io.Writer, rows []Row) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "勤怠"
+	if err := f.SetSheetName(f.GetSheetName(0), sheetName); err != nil {
+		return err
+	}
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return err
+	}
+	if err := sw.SetRow("A1", toCells(header)); err != nil {
+		return err
+	}
+	for i, r := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return err
+		}
+		if err := sw.SetRow(cell, toCells(r.values())); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	_, err = f.WriteTo(w)
+	return err
+}
+
+func toCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	return cells
+}
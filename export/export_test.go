@@ -0,0 +1,42 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+)
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	rows := []Row{
+		{UserID: "U1", Name: "+山田", Record: spreadsheet.Record{
+			Date: "2026-10-16", Time: "09:00:00", Type: spreadsheet.TypeStart,
+			Message: `=HYPERLINK("https://example.com","click")`, Location: "-office", Report: "@SUM(A1)",
+		}},
+		{UserID: "U2", Name: "佐藤", Record: spreadsheet.Record{
+			Date: "2026-10-16", Time: "18:00:00", Type: spreadsheet.TypeFinish,
+			Message: "お疲れさまでした a=b", WorkTime: "8:00", Report: "\t=1+1",
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, rows); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		header,
+		{"U1", "'+山田", "2026-10-16", "09:00:00", spreadsheet.TypeStart, `'=HYPERLINK("https://example.com","click")`, "", "'-office", "'@SUM(A1)"},
+		{"U2", "佐藤", "2026-10-16", "18:00:00", spreadsheet.TypeFinish, "お疲れさまでした a=b", "8:00", "", "'\t=1+1"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV = %q, want %q", records, want)
+	}
+}
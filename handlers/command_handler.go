@@ -1,50 +1,128 @@
 package handlers
 
 import (
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/catalog"
 	"github.com/pyama86/slack-afk/go/commands"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
 	"github.com/slack-go/slack"
 )
 
 type CommandHandler struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	auditLog    *audit.Logger
 	commands    map[string]commands.Command
+	views       map[string]commands.ViewHandler
 }
 
-func NewCommandHandler(client *slack.Client, redisClient *store.RedisClient) *CommandHandler {
+func NewCommandHandler(client *slack.Client, redisClient store.Store, attendance *spreadsheet.Client, auditLog *audit.Logger) *CommandHandler {
 	h := &CommandHandler{
 		client:      client,
 		redisClient: redisClient,
+		auditLog:    auditLog,
 		commands:    make(map[string]commands.Command),
+		views:       make(map[string]commands.ViewHandler),
 	}
 
-	h.commands["/afk"] = commands.NewAfkCommand(client, redisClient)
-	h.commands["/lunch"] = commands.NewLunchCommand(client, redisClient)
-	h.commands["/start"] = commands.NewStartCommand(client, redisClient)
-	h.commands["/finish"] = commands.NewFinishCommand(client, redisClient)
-	h.commands["/comeback"] = commands.NewComebackCommand(client, redisClient)
-	h.commands["/cancel_last"] = commands.NewCancelLastCommand(client, redisClient)
+	h.commands["/start"] = commands.NewStartCommand(client, redisClient, attendance, auditLog)
+	h.commands["/finish"] = commands.NewFinishCommand(client, redisClient, attendance, auditLog)
+	h.commands["/comeback"] = commands.NewComebackCommand(client, redisClient, attendance, auditLog)
+	h.commands["/cancel_last"] = commands.NewCancelLastCommand(client, redisClient, attendance, auditLog)
+	h.commands["/rebuild_summary"] = commands.NewRebuildSummaryCommand(client, redisClient, attendance, auditLog)
+	h.commands["/export"] = commands.NewExportCommand(client, redisClient, attendance, auditLog)
+	h.commands["/afk-admin"] = commands.NewAfkAdminCommand(client, redisClient, attendance, auditLog)
+	h.commands["/history"] = commands.NewHistoryCommand(client, redisClient, attendance, auditLog)
+	h.commands["/who"] = commands.NewWhoCommand(client, redisClient, attendance, auditLog)
+
+	// /afk, /lunch and a command per status of the catalog
+	for _, entry := range catalog.Current().Entries() {
+		if _, ok := h.commands[entry.Command()]; ok {
+			slog.Warn("Status name collides with a command", slog.String("status", entry.Name))
+			continue
+		}
+		h.commands[entry.Command()] = commands.NewStatusCommand(client, redisClient, attendance, auditLog, entry)
+	}
+
+	// Modals opened by the commands
+	for _, command := range h.commands {
+		if v, ok := command.(commands.ViewHandler); ok {
+			h.views[v.CallbackID()] = v
+		}
+	}
 
 	return h
 }
 
 func (h *CommandHandler) Handle(cmd slack.SlashCommand) {
 	slog.Info("Received command", slog.String("command", cmd.Command), slog.String("user", cmd.UserName))
+	h.auditLog.Record(audit.Entry{
+		Actor:  cmd.UserID,
+		Action: "command",
+		Source: audit.SourceSlash,
+		Detail: strings.TrimSpace(cmd.Command + " " + cmd.Text),
+	})
 
-	if command, ok := h.commands[cmd.Command]; ok {
-		if err := command.Execute(cmd); err != nil {
-			slog.Error("Failed to execute command", slog.String("command", cmd.Command), slog.Any("error", err))
-			if _, err := h.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText("Failed to execute command: "+err.Error(), false)); err != nil {
-				slog.Error("Failed to post ephemeral message", slog.Any("error", err))
-			}
-		}
-	} else {
+	command, ok := h.commands[cmd.Command]
+	if !ok {
 		slog.Info("Unknown command", slog.String("command", cmd.Command))
-		if _, err := h.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText("Unknown command: "+cmd.Command, false)); err != nil {
-			slog.Error("Failed to post ephemeral message", slog.Any("error", err))
-		}
+		h.postEphemeral(cmd, "Unknown command: "+cmd.Command)
+		return
+	}
+
+	usage := command.Usage()
+	args, err := commands.ParseArgs(cmd.Text, usage)
+	if err == nil && args.Help {
+		h.postEphemeral(cmd, usage.Help())
+		return
+	}
+	if err == nil {
+		err = command.Execute(cmd, args)
+	}
+	if err == nil {
+		return
+	}
+
+	if ue, ok := commands.IsUsageError(err); ok {
+		h.postEphemeral(cmd, fmt.Sprintf(":warning: %s\n使い方: `%s`（詳しくは `%s help`）", ue.Message, usage.Line(), usage.Command))
+		return
+	}
+	slog.Error("Failed to execute command", slog.String("command", cmd.Command), slog.Any("error", err))
+	h.postEphemeral(cmd, "Failed to execute command: "+err.Error())
+}
+
+// HandleViewSubmission routes the submission of a modal to the command that opened it
+func (h *CommandHandler) HandleViewSubmission(callback slack.InteractionCallback) {
+	h.auditLog.Record(audit.Entry{
+		Actor:  callback.User.ID,
+		Action: "view_submission",
+		Source: audit.SourceButton,
+		Detail: callback.View.CallbackID,
+	})
+
+	v, ok := h.views[callback.View.CallbackID]
+	if !ok {
+		slog.Info("Unknown view", slog.String("callback_id", callback.View.CallbackID))
+		return
+	}
+	if err := v.HandleViewSubmission(callback); err != nil {
+		slog.Error("Failed to handle view submission", slog.String("callback_id", callback.View.CallbackID), slog.Any("error", err))
+	}
+}
+
+// PostStandupDigest posts the plans of the members of channelID and who hasn't started, as of now
+func (h *CommandHandler) PostStandupDigest(channelID string, now time.Time) error {
+	return commands.PostStandupDigest(h.client, h.redisClient, h.auditLog, channelID, now)
+}
+
+func (h *CommandHandler) postEphemeral(cmd slack.SlashCommand, text string) {
+	if _, err := h.client.PostEphemeral(cmd.ChannelID, cmd.UserID, slack.MsgOptionText(text, false)); err != nil {
+		slog.Error("Failed to post ephemeral message", slog.Any("error", err))
 	}
 }
@@ -5,21 +5,30 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/pyama86/slack-afk/go/audit"
 	"github.com/pyama86/slack-afk/go/presentation/blocks"
 	"github.com/pyama86/slack-afk/go/store"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 )
 
+// ignoredPattern matches messages of karma bots, which mention users without talking to them
+var ignoredPattern = regexp.MustCompile(`\+\+|is up to [0-9]+ points!`)
+
+// mentionPattern matches a user mention such as <@U0123ABCD> or <@U0123ABCD|name>
+var mentionPattern = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|[^>]*)?>`)
+
 type EventHandler struct {
 	client      *slack.Client
-	redisClient *store.RedisClient
+	redisClient store.Store
+	auditLog    *audit.Logger
 }
 
-func NewEventHandler(client *slack.Client, redisClient *store.RedisClient) *EventHandler {
+func NewEventHandler(client *slack.Client, redisClient store.Store, auditLog *audit.Logger) *EventHandler {
 	return &EventHandler{
 		client:      client,
 		redisClient: redisClient,
+		auditLog:    auditLog,
 	}
 }
 
@@ -54,26 +63,24 @@ func (h *EventHandler) HandleMessage(ev *slackevents.MessageEvent) error {
 		return nil
 	}
 
+	// Most messages mention nobody, so skip them before touching Redis
+	mentioned := mentionedUserIDs(ev.Text)
+	if len(mentioned) == 0 {
+		return nil
+	}
+
 	// Ignore certain patterns
-	if matched, _ := regexp.MatchString(`\+\+|is up to [0-9]+ points!`, ev.Text); matched {
+	if ignoredPattern.MatchString(ev.Text) {
 		return nil
 	}
 
-	// Get registered users
-	registeredUsers, err := h.redisClient.GetListRange("registered", 0, -1)
+	// Find mentioned users whose auto-response is on
+	mentionedUsers, err := h.redisClient.FilterRegistered(mentioned)
 	if err != nil {
 		slog.Error("Failed to get registered users", slog.Any("error", err))
 		return err
 	}
 
-	// Find mentioned users
-	var mentionedUsers []string
-	for _, uid := range registeredUsers {
-		if strings.Contains(ev.Text, "<@"+uid+">") {
-			mentionedUsers = append(mentionedUsers, uid)
-		}
-	}
-
 	// Process each mentioned user
 	for _, uid := range mentionedUsers {
 		// Get user's away message
@@ -82,44 +89,15 @@ func (h *EventHandler) HandleMessage(ev *slackevents.MessageEvent) error {
 			continue
 		}
 
-		// Update user's mention history
-		userPresence, err := h.redisClient.GetUserPresence(uid)
+		// Add new mention to user's mention history
+		err = h.redisClient.AddMention(uid, store.Mention{
+			Channel: ev.Channel,
+			User:    ev.User,
+			Text:    strings.ReplaceAll(ev.Text, "<@"+uid+">", ""),
+			EventTS: ev.TimeStamp,
+		})
 		if err != nil {
-			slog.Error("Failed to get user presence", slog.Any("error", err))
-			continue
-		}
-
-		// Initialize mention history if needed
-		if userPresence["mention_history"] == nil || isMap(userPresence["mention_history"]) {
-			userPresence["mention_history"] = []interface{}{}
-		}
-
-		// Add new mention to history
-		mentionHistory, ok := userPresence["mention_history"].([]interface{})
-		if !ok {
-			mentionHistory = []interface{}{}
-		}
-
-		// Create mention record
-		mentionText := ev.Text
-		if mentionText != "" {
-			mentionText = strings.ReplaceAll(mentionText, "<@"+uid+">", "")
-		}
-
-		mention := map[string]interface{}{
-			"channel":  ev.Channel,
-			"user":     ev.User,
-			"text":     mentionText,
-			"event_ts": ev.TimeStamp,
-		}
-
-		// Add to history
-		mentionHistory = append(mentionHistory, mention)
-		userPresence["mention_history"] = mentionHistory
-
-		// Save updated user presence
-		if err := h.redisClient.SetUserPresence(uid, userPresence); err != nil {
-			slog.Error("Failed to set user presence", slog.Any("error", err))
+			slog.Error("Failed to add mention history", slog.Any("error", err))
 			continue
 		}
 
@@ -133,15 +111,33 @@ func (h *EventHandler) HandleMessage(ev *slackevents.MessageEvent) error {
 			slog.Error("Failed to post auto-response", slog.Any("error", err))
 			continue
 		}
+		h.auditLog.Record(audit.Entry{
+			Actor:  ev.User,
+			Target: uid,
+			Action: "auto_response",
+			Source: audit.SourceEvent,
+			After:  message,
+			Detail: ev.Channel + " " + ev.TimeStamp,
+		})
 	}
 
 	return nil
 }
 
-// Helper function to check if an interface is a map
-func isMap(v interface{}) bool {
-	_, ok := v.(map[string]interface{})
-	return ok
+// mentionedUserIDs returns the users mentioned in text, once each and in order of appearance
+func mentionedUserIDs(text string) []string {
+	if !strings.Contains(text, "<@") {
+		return nil
+	}
+	var uids []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if uid := m[1]; !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	return uids
 }
 
 func (h *EventHandler) HandleHelp(ev *slackevents.AppMentionEvent) error {
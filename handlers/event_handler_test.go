@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMentionedUserIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"no mention", "おはようございます", nil},
+		{"user", "<@U0123ABCD> レビューお願いします", []string{"U0123ABCD"}},
+		{"with name", "<@U0123ABCD|yamada> さん", []string{"U0123ABCD"}},
+		{"enterprise user", "cc <@W0123ABCD>", []string{"W0123ABCD"}},
+		{"several", "<@U1> <@W2|suzuki> <@U3>", []string{"U1", "W2", "U3"}},
+		{"repeated", "<@U1> と <@U2>、<@U1|yamada> もう一度", []string{"U1", "U2"}},
+		{"channel and group", "<#C0123ABCD|general> <!subteam^S0123|@team> <!here>", nil},
+		{"lowercase id", "<@u0123abcd>", nil},
+		{"unterminated", "<@U0123ABCD", nil},
+		{"email-like", "mail me at foo<@example.com>", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mentionedUserIDs(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mentionedUserIDs(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkMentionedUserIDs(b *testing.B) {
+	texts := map[string]string{
+		"none":     "今日のデプロイは 15:00 からです。問題があればこのスレッドに書いてください。",
+		"one":      "<@U0123ABCD> 先ほどの PR、レビューお願いできますか？ https://github.com/example/repo/pull/1234",
+		"several":  "<@U0123ABCD> <@U0456EFGH|suzuki> <@W0789IJKL> 明日の定例は <#C0123ABCD|general> で 10:00 からです。<@U0123ABCD> は議事録をお願いします",
+		"long":     strings.Repeat("ログを貼ります: ERROR connection reset by peer (retrying in 5s)\n", 50) + "<@U0123ABCD> 見てもらえますか",
+		"karmabot": "<@U0123ABCD>++ thanks for the help!",
+	}
+	for name, text := range texts {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				mentionedUserIDs(text)
+			}
+		})
+	}
+}
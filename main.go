@@ -1,20 +1,80 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/pyama86/slack-afk/go/catalog"
 	"github.com/pyama86/slack-afk/go/slack"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
 	"github.com/pyama86/slack-afk/go/store"
+	slackapi "github.com/slack-go/slack"
 )
 
-func validateEnv() error {
-	requiredEnv := []string{
-		"SLACK_BOT_TOKEN",
-		"SLACK_APP_TOKEN",
+const usage = `Usage: afk <command> [options]
+
+Commands:
+  serve                              Run the Slack bot (default)
+  report  [--team T] [--user U...] [--month YYYY-MM]
+                                     Print daily attendance summaries
+  recalc  [--team T] [--month YYYY-MM]
+                                     Recompute every 実働時間 cell of the month
+  migrate [USERID=sheet1,sheet2 ...] Run store and sheet migrations
+  export  [--team T] [--user U...|all] [--month YYYY-MM] [--format csv|xlsx] [--out FILE]
+                                     Write attendance records to a file
+
+--team selects an OAuth-installed workspace (default: the team of SLACK_BOT_TOKEN).
+`
+
+func main() {
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			slog.Error("Failed to load .env file", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	if err := catalog.LoadFromEnv(); err != nil {
+		slog.Error("Failed to load the status catalog", slog.Any("error", err))
+		os.Exit(1)
 	}
+
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "report":
+		err = runReport(args)
+	case "recalc":
+		err = runRecalc(args)
+	case "migrate":
+		err = runMigrate(args)
+	case "export":
+		err = runExport(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("Command failed", slog.String("command", command), slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+func validateEnv(requiredEnv ...string) error {
 	for _, env := range requiredEnv {
 		if os.Getenv(env) == "" {
 			return fmt.Errorf("environment variable %s is not set", env)
@@ -23,33 +83,122 @@ func validateEnv() error {
 	return nil
 }
 
-func main() {
-	if _, err := os.Stat(".env"); err == nil {
-		if err := godotenv.Load(); err != nil {
-			slog.Error("Failed to load .env file", slog.Any("error", err))
-			os.Exit(1)
+func newSlackClient() *slackapi.Client {
+	return slack.NewAPIClient(
+		os.Getenv("SLACK_BOT_TOKEN"),
+		slackapi.OptionAppLevelToken(os.Getenv("SLACK_APP_TOKEN")),
+	)
+}
+
+// defaultTeamID returns the team of SLACK_BOT_TOKEN, or "" when it is not set
+func defaultTeamID(ctx context.Context, api *slackapi.Client) (string, error) {
+	if os.Getenv("SLACK_BOT_TOKEN") == "" {
+		return "", nil
+	}
+	resp, err := api.AuthTestContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify the team of SLACK_BOT_TOKEN: %w", err)
+	}
+	return resp.TeamID, nil
+}
+
+// newStore connects to the store of REDIS_URL: Redis, or SQLite for sqlite:///path
+func newStore() (store.Store, error) {
+	opts := store.Options{
+		URL:            os.Getenv("REDIS_URL"),
+		SentinelAddrs:  splitList(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		SentinelMaster: os.Getenv("REDIS_SENTINEL_MASTER"),
+		ClusterAddrs:   splitList(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		CAFile:         os.Getenv("REDIS_TLS_CA_FILE"),
+		KeyPrefix:      os.Getenv("REDIS_KEY_PREFIX"),
+	}
+	if opts.URL == "" && opts.SentinelMaster == "" && len(opts.ClusterAddrs) == 0 {
+		opts.URL = "redis://localhost:6379"
+	}
+	return store.Open(opts)
+}
+
+// splitList splits a comma-separated environment variable, dropping empty items
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
+}
 
-	if err := validateEnv(); err != nil {
-		slog.Error("Environment validation failed", slog.Any("error", err))
-		os.Exit(1)
+// legacyKeysOptIn reports whether AFK_MIGRATE_LEGACY_KEYS asks to move the keys of a single-workspace deployment
+func legacyKeysOptIn() bool {
+	v, _ := strconv.ParseBool(os.Getenv("AFK_MIGRATE_LEGACY_KEYS"))
+	return v
+}
+
+// newAttendanceClient returns nil when no spreadsheet is configured for the team.
+// claims is the store the record IDs of the commands are claimed in; tools that write no records pass nil.
+func newAttendanceClient(ctx context.Context, api *slackapi.Client, claims spreadsheet.Claims, teamID, defaultTeamID string) (*spreadsheet.Client, error) {
+	spreadsheetID := spreadsheet.SpreadsheetID(teamID, defaultTeamID)
+	if spreadsheetID == "" {
+		return nil, nil
+	}
+	attendance, err := spreadsheet.NewClient(ctx, api, claims, spreadsheetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize attendance client for %s: %w", spreadsheetID, err)
 	}
+	return attendance, nil
+}
 
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "redis://localhost:6379"
+// requireAttendanceClient returns the attendance client of a team for commands that only work with the spreadsheet.
+// An empty teamID means the team of SLACK_BOT_TOKEN; other teams use the bot token stored by the OAuth install.
+func requireAttendanceClient(ctx context.Context, teamID string) (*spreadsheet.Client, error) {
+	api := newSlackClient()
+	defaultTeam, err := defaultTeamID(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+	if teamID == "" {
+		teamID = defaultTeam
+	} else if teamID != defaultTeam {
+		redisClient, err := newStore()
+		if err != nil {
+			return nil, err
+		}
+		inst, err := redisClient.GetInstallation(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+		if inst == nil {
+			return nil, fmt.Errorf("team %s has not installed the app", teamID)
+		}
+		api = slack.NewAPIClient(inst.BotToken)
 	}
 
-	redisClient, err := store.NewRedisClient(redisURL)
+	attendance, err := newAttendanceClient(ctx, api, nil, teamID, defaultTeam)
 	if err != nil {
-		slog.Error("Failed to initialize Redis client", slog.Any("error", err))
-		os.Exit(1)
+		return nil, err
 	}
+	if attendance == nil {
+		return nil, fmt.Errorf("no attendance spreadsheet is configured for team %q (ATTENDANCE_SPREADSHEET_ID or ATTENDANCE_SPREADSHEET_IDS)", teamID)
+	}
+	return attendance, nil
+}
 
-	slog.Info("Starting Slack bot...")
-	if err := slack.StartSocketModeServer(redisClient); err != nil {
-		slog.Error("Failed to start server", slog.Any("error", err))
-		os.Exit(1)
+func currentMonth() string {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	return time.Now().In(jst).Format("2006-01")
+}
+
+// userList splits a comma separated --user flag. "all" and "" mean every user.
+func userList(s string) []string {
+	if s == "" || s == "all" {
+		return nil
+	}
+	var users []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			users = append(users, u)
+		}
 	}
+	return users
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+)
+
+// runMigrate runs the Redis store migrations and, when the spreadsheet is configured,
+// merges attendance sheets split by display name changes.
+// Extra arguments of the form USERID=sheet1,sheet2 merge the listed sheets into that user's sheet.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	legacyKeys := fs.Bool("legacy-keys", legacyKeysOptIn(), "move the Redis keys of a single-workspace deployment under the team of SLACK_BOT_TOKEN")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	api := newSlackClient()
+	teamID, err := defaultTeamID(ctx, api)
+	if err != nil {
+		return err
+	}
+
+	redisClient, err := newStore()
+	if err != nil {
+		return err
+	}
+	applied, err := redisClient.Migrate(ctx, store.MigrationEnv{LegacyTeamID: teamID, LegacyKeys: *legacyKeys})
+	if err != nil {
+		return err
+	}
+	for _, id := range applied {
+		fmt.Printf("store: applied %s\n", id)
+	}
+
+	// sheets are merged only for the team of SLACK_BOT_TOKEN.
+	// The store is shared with serve so that merging blocks the attendance writes of the user.
+	attendance, err := newAttendanceClient(ctx, api, redisClient, teamID, teamID)
+	if err != nil {
+		return err
+	}
+	if attendance == nil {
+		if fs.NArg() > 0 {
+			return fmt.Errorf("no attendance spreadsheet is configured for the team of SLACK_BOT_TOKEN")
+		}
+		return nil
+	}
+	return migrateSheets(ctx, attendance, fs.Args())
+}
+
+func migrateSheets(ctx context.Context, attendance *spreadsheet.Client, args []string) error {
+	results, err := attendance.MigrateRenamedSheets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		userID, sheets, ok := strings.Cut(arg, "=")
+		if !ok || userID == "" || sheets == "" {
+			return fmt.Errorf("invalid argument %q, expected USERID=sheet1,sheet2", arg)
+		}
+		result, err := attendance.MergeSheets(ctx, userID, strings.Split(sheets, ",")...)
+		if err != nil {
+			return err
+		}
+		results = append(results, *result)
+	}
+
+	for _, r := range results {
+		fmt.Printf("sheets: %s: %s <- %s (%d rows)\n", r.UserID, r.Sheet, strings.Join(r.Merged, ", "), r.Rows)
+	}
+	return nil
+}
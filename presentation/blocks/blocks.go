@@ -1,56 +1,36 @@
 package blocks
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/pyama86/slack-afk/go/catalog"
 	"github.com/slack-go/slack"
 )
 
-// AfkBlocks creates blocks for afk command response
-func AfkBlocks(userName string, text string) []slack.Block {
-	var blocks []slack.Block
-
-	if text != "" {
-		blocks = append(blocks, slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", ":walking: *"+userName+"が離席しました*\n「"+text+"」", false, false),
-			nil,
-			nil,
-		))
-	} else {
-		blocks = append(blocks, slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", ":walking: *"+userName+"が離席しました*\n代わりに不在をお伝えします", false, false),
+// StatusBlocks creates blocks for the announcement of a catalog status (/afk, /lunch, /meeting, ...)
+func StatusBlocks(announcement string) []slack.Block {
+	return []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", announcement, false, false),
 			nil,
 			nil,
-		))
+		),
 	}
-
-	return blocks
 }
 
-// LunchBlocks creates blocks for lunch command response
-func LunchBlocks(userName string, text string) []slack.Block {
-	var blocks []slack.Block
-
-	if text != "" {
-		blocks = append(blocks, slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", ":bento: *"+userName+"がランチに行きました*\n「"+text+"」", false, false),
-			nil,
-			nil,
-		))
-	} else {
-		blocks = append(blocks, slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", ":bento: *"+userName+"がランチに行きました*\n何食べるんでしょうね？", false, false),
-			nil,
-			nil,
-		))
+// StartBlocks creates blocks for start command response. location and plan are empty when not given.
+func StartBlocks(userName, location, plan string) []slack.Block {
+	text := ":sunrise: *" + userName + "が始業しました*"
+	if location != "" {
+		text += "（" + location + "）"
+	}
+	if plan != "" {
+		text += "\n*今日の予定*\n" + plan
 	}
-
-	return blocks
-}
-
-// StartBlocks creates blocks for start command response
-func StartBlocks(userName string) []slack.Block {
 	return []slack.Block{
 		slack.NewSectionBlock(
-			slack.NewTextBlockObject("mrkdwn", ":sunrise: *"+userName+"が始業しました*", false, false),
+			slack.NewTextBlockObject("mrkdwn", text, false, false),
 			nil,
 			nil,
 		),
@@ -89,14 +69,73 @@ func ComebackBlocks(userName string) []slack.Block {
 	}
 }
 
+// StandupPlan is the plan of one user in the standup digest
+type StandupPlan struct {
+	UserID   string
+	Location string // empty when not given
+	Plan     string // empty when /start was run without --plan
+}
+
+// maxDigestPlans keeps the digest within the 50 blocks of a message
+const maxDigestPlans = 45
+
+// StandupDigestBlocks creates the standup digest of a day: the plans of those who started and who hasn't started yet
+func StandupDigestBlocks(date string, plans []StandupPlan, notStarted []string) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(
+			slack.NewTextBlockObject("plain_text", date+"の予定", false, false),
+		),
+	}
+	for i, p := range plans {
+		if i == maxDigestPlans {
+			blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("ほか%d人が始業しています", len(plans)-i), false, false)))
+			break
+		}
+		text := "<@" + p.UserID + ">"
+		if p.Location != "" {
+			text += "（" + p.Location + "）"
+		}
+		if p.Plan != "" {
+			text += "\n" + p.Plan
+		} else {
+			text += "\n予定は入力されていません"
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil))
+	}
+	if len(plans) == 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", "まだ誰も始業していません", false, false), nil, nil))
+	}
+	if len(notStarted) > 0 {
+		mentions := make([]string, len(notStarted))
+		for i, uid := range notStarted {
+			mentions[i] = "<@" + uid + ">"
+		}
+		blocks = append(blocks, slack.NewDividerBlock(), slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", ":hourglass_flowing_sand: *まだ始業していない人*\n"+strings.Join(mentions, " "), false, false),
+			nil,
+			nil,
+		))
+	}
+	return blocks
+}
+
 // HelpBlocks creates blocks for help command response
 func HelpBlocks() []slack.Block {
 	helpText := "*使用可能なコマンド:*\n" +
-		"• `/afk [メッセージ]` - 離席状態にする\n" +
-		"• `/lunch [メッセージ]` - ランチ中の状態にする（1時間後に自動解除）\n" +
-		"• `/start` - 始業状態にする\n" +
-		"• `/finish [メッセージ]` - 退勤状態にする（翌日朝まで自動応答）\n" +
-		"• `/comeback` - 離席状態を解除する"
+		"• `/afk [時間] [メッセージ]` - 離席状態にする（時間を指定すると自動解除、`--type meeting` で会議などの状態にする）\n" +
+		"• `/lunch [時間] [メッセージ]` - ランチ中の状態にする（デフォルトは1時間後に自動解除）\n" +
+		statusHelp() +
+		"• `/start [勤務地]` - 始業状態にする（`office` `remote` `客先` などの勤務地を記録。`--plan` で今日の予定を入力）\n" +
+		"• `/who [@user]` - チャンネルのメンバーの勤務地と状態を表示する\n" +
+		"• `/finish [HH:MM] [メッセージ]` - 退勤状態にする（指定時刻、デフォルトは翌朝9:00まで自動応答。`--report` で日報を入力）\n" +
+		"• `/comeback` - 離席状態を解除する\n" +
+		"• `/cancel_last` - 直近の勤怠記録を取り消す\n" +
+		"• `/rebuild_summary` - 勤怠の集計シートを作り直す\n" +
+		"• `/export [YYYY-MM] [@user|all] [csv|xlsx]` - 勤怠をファイルにしてDMに送る\n" +
+		"• `/history [件数]` - 自分の状態変更や勤怠記録の履歴を表示する\n" +
+		"• `/afk-admin <サブコマンド>` - 他のユーザーの状態や勤怠記録を直す（管理者のみ）\n\n" +
+		"`--quiet` でチャンネルに投稿せず、`--channel #channel` で別のチャンネルに投稿します。\n" +
+		"各コマンドの詳しい使い方は `/afk help` のように `help` を付けて実行してください。"
 
 	return []slack.Block{
 		slack.NewHeaderBlock(
@@ -109,3 +148,15 @@ func HelpBlocks() []slack.Block {
 		),
 	}
 }
+
+// statusHelp lists the commands of the catalog statuses other than /afk and /lunch
+func statusHelp() string {
+	var b strings.Builder
+	for _, e := range catalog.Current().Entries() {
+		if e.Name == catalog.Afk || e.Name == catalog.Lunch {
+			continue
+		}
+		fmt.Fprintf(&b, "• `%s [時間] [メッセージ]` - %s %sの状態にする\n", e.Command(), e.Emoji, e.Type)
+	}
+	return b.String()
+}
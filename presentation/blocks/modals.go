@@ -0,0 +1,93 @@
+package blocks
+
+import (
+	"github.com/slack-go/slack"
+)
+
+// Callback IDs of the modals
+const (
+	StartPlanCallbackID    = "start_plan"    // opened by /start --plan
+	FinishReportCallbackID = "finish_report" // opened by /finish --report
+)
+
+// Block IDs of the modals. Each input uses its block ID as action ID.
+const (
+	PlanBlock           = "plan"
+	ReportDoneBlock     = "report_done"
+	ReportBlockersBlock = "report_blockers"
+	ReportTomorrowBlock = "report_tomorrow"
+)
+
+// maxInputLength keeps an answer within the 3000 characters of a section block
+const maxInputLength = 2900
+
+// MorningPlanModal creates the modal /start --plan opens. metadata is returned with the submission.
+func MorningPlanModal(metadata string) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      StartPlanCallbackID,
+		Title:           slack.NewTextBlockObject("plain_text", "今日の予定", false, false),
+		Submit:          slack.NewTextBlockObject("plain_text", "始業する", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "キャンセル", false, false),
+		PrivateMetadata: metadata,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			textInput(PlanBlock, "今日やること", "", false),
+		}},
+	}
+}
+
+// DailyReportModal creates the modal /finish --report opens. metadata is returned with the submission.
+func DailyReportModal(metadata string) slack.ModalViewRequest {
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      FinishReportCallbackID,
+		Title:           slack.NewTextBlockObject("plain_text", "日報", false, false),
+		Submit:          slack.NewTextBlockObject("plain_text", "退勤する", false, false),
+		Close:           slack.NewTextBlockObject("plain_text", "キャンセル", false, false),
+		PrivateMetadata: metadata,
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			textInput(ReportDoneBlock, "今日やったこと", "", false),
+			textInput(ReportBlockersBlock, "困っていること・課題", "なければ空のままで", true),
+			textInput(ReportTomorrowBlock, "明日の予定", "", true),
+		}},
+	}
+}
+
+// DailyReportBlocks creates the post of a daily report. Empty answers are left out.
+func DailyReportBlocks(userName, done, blockers, tomorrow string) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", ":memo: *"+userName+"の日報*", false, false),
+			nil,
+			nil,
+		),
+	}
+	for _, s := range []struct{ title, text string }{
+		{"今日やったこと", done},
+		{"困っていること・課題", blockers},
+		{"明日の予定", tomorrow},
+	} {
+		if s.text == "" {
+			continue
+		}
+		blocks = append(blocks, slack.NewSectionBlock(
+			slack.NewTextBlockObject("mrkdwn", "*"+s.title+"*\n"+s.text, false, false),
+			nil,
+			nil,
+		))
+	}
+	return blocks
+}
+
+// textInput is a multiline plain text input whose action ID is its block ID
+func textInput(blockID, label, placeholder string, optional bool) *slack.InputBlock {
+	element := slack.NewPlainTextInputBlockElement(nil, blockID)
+	element.Multiline = true
+	element.MaxLength = maxInputLength
+	if placeholder != "" {
+		element.Placeholder = slack.NewTextBlockObject("plain_text", placeholder, false, false)
+	}
+	input := slack.NewInputBlock(blockID, slack.NewTextBlockObject("plain_text", label, false, false), nil, element)
+	input.Optional = optional
+	return input
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+func runRecalc(args []string) error {
+	fs := flag.NewFlagSet("recalc", flag.ExitOnError)
+	team := fs.String("team", "", "Slack team ID of an OAuth-installed workspace")
+	month := fs.String("month", currentMonth(), "month to recompute (YYYY-MM)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	attendance, err := requireAttendanceClient(ctx, *team)
+	if err != nil {
+		return err
+	}
+	updated, err := attendance.Recalc(ctx, *month)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: updated %d cells\n", *month, updated)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+)
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	team := fs.String("team", "", "Slack team ID of an OAuth-installed workspace")
+	user := fs.String("user", "", "comma separated Slack user IDs (default: all users)")
+	month := fs.String("month", currentMonth(), "month to report (YYYY-MM)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	attendance, err := requireAttendanceClient(ctx, *team)
+	if err != nil {
+		return err
+	}
+	users := userList(*user)
+	if len(users) == 0 {
+		if users, err = attendance.Users(ctx, *month); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, uid := range users {
+		name, summaries, err := attendance.MonthSummaries(ctx, uid, *month)
+		if err != nil {
+			return err
+		}
+		if len(summaries) == 0 {
+			continue
+		}
+		printSummaries(w, uid, name, summaries)
+	}
+	return w.Flush()
+}
+
+func printSummaries(w *tabwriter.Writer, uid, name string, summaries []spreadsheet.DaySummary) {
+	fmt.Fprintf(w, "%s (%s)\n", name, uid)
+	fmt.Fprintln(w, "日付\t出勤\t退勤\t休憩\t実働時間\t勤務地\t")
+
+	var days int
+	var total time.Duration
+	locations := map[string]int{}
+	for _, d := range summaries {
+		if d.Location != "" {
+			locations[d.Location]++
+		}
+		work := "-"
+		if d.HasWork() {
+			work = formatHours(d.Work)
+			days++
+			total += d.Work
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t\n", d.Date, orDash(d.Start), orDash(d.Finish), formatHours(d.Break), work, orDash(d.Location))
+	}
+	fmt.Fprintf(w, "出勤日数 %d日 / 合計実働 %s\n", days, formatHours(total))
+	if len(locations) > 0 {
+		fmt.Fprintf(w, "勤務地 %s\n", formatLocationDays(locations))
+	}
+	fmt.Fprintln(w)
+}
+
+// formatLocationDays writes the days per work location as "office 12日 / remote 8日", by name
+func formatLocationDays(locations map[string]int) string {
+	names := make([]string, 0, len(locations))
+	for l := range locations {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, l := range names {
+		parts[i] = fmt.Sprintf("%s %d日", l, locations[l])
+	}
+	return strings.Join(parts, " / ")
+}
+
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/background"
+	"github.com/pyama86/slack-afk/go/slack"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	slackapi "github.com/slack-go/slack"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// SIGINT and SIGTERM stop the transports; the work already accepted is drained before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTimeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q: %w", v, err)
+		}
+		shutdownTimeout = d
+	}
+
+	// A deployment serves the team of SLACK_BOT_TOKEN, the teams installed through OAuth, or both
+	oauth := os.Getenv("SLACK_CLIENT_ID") != ""
+	if oauth {
+		if err := validateEnv("SLACK_CLIENT_SECRET"); err != nil {
+			return err
+		}
+	} else if err := validateEnv("SLACK_BOT_TOKEN"); err != nil {
+		return err
+	}
+
+	transport := os.Getenv("SLACK_TRANSPORT")
+	switch transport {
+	case "", "socket":
+		transport = "socket"
+		if err := validateEnv("SLACK_APP_TOKEN"); err != nil {
+			return err
+		}
+	case "http":
+		if err := validateEnv("SLACK_SIGNING_SECRET"); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown SLACK_TRANSPORT %q (socket or http)", transport)
+	}
+
+	redisClient, err := newStore()
+	if err != nil {
+		return err
+	}
+
+	var (
+		api        *slackapi.Client
+		teamID     string
+		attendance *spreadsheet.Client
+	)
+	if os.Getenv("SLACK_BOT_TOKEN") != "" {
+		api = newSlackClient()
+		teamID, err = defaultTeamID(ctx, api)
+		if err != nil {
+			return err
+		}
+		attendance, err = newAttendanceClient(ctx, api, redisClient, teamID, teamID)
+		if err != nil {
+			return err
+		}
+	}
+
+	applied, err := redisClient.Migrate(ctx, store.MigrationEnv{LegacyTeamID: teamID, LegacyKeys: legacyKeysOptIn()})
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		slog.Info("Applied store migrations", slog.Any("ids", applied))
+	}
+
+	// Audit entries go to the store unless AUDIT_LOG_FILE is set
+	var auditBackend audit.Backend
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		auditBackend, err = audit.NewFileBackend(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	workspaces := slack.NewWorkspaces(redisClient, api, teamID, attendance, auditBackend)
+	workers, err := envInt("SLACK_WORKERS", 8)
+	if err != nil {
+		return err
+	}
+	dispatcher := slack.NewDispatcher(workspaces, workers)
+
+	// The standup digest is posted for the team of SLACK_BOT_TOKEN, whose channel AFK_STANDUP_CHANNEL names
+	if channelID := os.Getenv("AFK_STANDUP_CHANNEL"); channelID != "" {
+		at, err := standupTime()
+		if err != nil {
+			return err
+		}
+		if api == nil {
+			slog.Warn("AFK_STANDUP_CHANNEL needs SLACK_BOT_TOKEN; the standup digest is disabled")
+		} else {
+			slog.Info("Standup digest enabled", slog.String("channel", channelID), slog.String("time", at.Format("15:04")))
+			background.Go("standup", func() { workspaces.RunStandupDigest(ctx, at.Hour(), at.Minute(), channelID) })
+		}
+	}
+
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		addr = ":3000"
+	}
+	var routes []slack.Routes
+	if oauth {
+		installer := slack.NewInstaller(
+			os.Getenv("SLACK_CLIENT_ID"),
+			os.Getenv("SLACK_CLIENT_SECRET"),
+			os.Getenv("SLACK_REDIRECT_URL"),
+			os.Getenv("SLACK_SCOPES"),
+			redisClient,
+			workspaces,
+		)
+		routes = append(routes, installer.Routes)
+	}
+
+	slog.Info("Starting Slack bot...", slog.String("transport", transport), slog.String("team", teamID), slog.Bool("oauth", oauth))
+	if transport == "http" {
+		routes = append(routes, slack.EventRoutes(os.Getenv("SLACK_SIGNING_SECRET"), dispatcher))
+		err = slack.StartHTTPServer(ctx, addr, routes...)
+	} else {
+		if len(routes) > 0 {
+			// socket mode still needs an HTTP endpoint for the install flow
+			go func() {
+				if err := slack.StartHTTPServer(ctx, addr, routes...); err != nil {
+					slog.Error("HTTP server stopped", slog.Any("error", err))
+				}
+			}()
+		}
+		err = slack.StartSocketModeServer(ctx, os.Getenv("SLACK_APP_TOKEN"), dispatcher)
+	}
+	stop()
+	shutdown(dispatcher, redisClient, shutdownTimeout)
+	return err
+}
+
+// shutdown waits up to timeout for the payloads being handled and the attendance writes they started,
+// then closes the Redis connection
+func shutdown(dispatcher *slack.Dispatcher, redisClient store.Store, timeout time.Duration) {
+	slog.Info("Shutting down...", slog.Duration("timeout", timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		dispatcher.Close()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		slog.Warn("Gave up waiting for event handlers")
+	}
+	if err := background.Wait(ctx); err != nil {
+		slog.Warn("Gave up waiting for background tasks", slog.Any("error", err))
+	}
+	if err := redisClient.Close(); err != nil {
+		slog.Error("Failed to close Redis client", slog.Any("error", err))
+	}
+	slog.Info("Shutdown complete")
+}
+
+// standupTime reads the time of day of the standup digest from AFK_STANDUP_TIME (HH:MM, default 10:00)
+func standupTime() (time.Time, error) {
+	v := os.Getenv("AFK_STANDUP_TIME")
+	if v == "" {
+		v = "10:00"
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid AFK_STANDUP_TIME %q (HH:MM): %w", v, err)
+	}
+	return t, nil
+}
+
+// envInt reads a positive integer from the environment, or returns def when it is unset
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer: %q", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Dispatcher routes Slack payloads to the command and event handlers of the team they came from.
+// Both the socket mode and the HTTP transports share it.
+// The Submit methods hand payloads to a worker pool keyed by team and user, so a slow Slack or Redis call
+// only delays the payloads of that user.
+type Dispatcher struct {
+	workspaces *Workspaces
+	pool       *workerPool
+}
+
+// NewDispatcher starts workers goroutines that handle the submitted payloads
+func NewDispatcher(workspaces *Workspaces, workers int) *Dispatcher {
+	return &Dispatcher{
+		workspaces: workspaces,
+		pool:       newWorkerPool(workers),
+	}
+}
+
+// Close stops accepting payloads and waits until the submitted ones are handled
+func (d *Dispatcher) Close() {
+	d.pool.Close()
+}
+
+func (d *Dispatcher) SubmitEventsAPI(payload slackevents.EventsAPIEvent) {
+	d.pool.Submit(payload.TeamID+":"+eventUser(payload), func() { d.DispatchEventsAPI(payload) })
+}
+
+func (d *Dispatcher) SubmitSlashCommand(cmd slack.SlashCommand) {
+	d.pool.Submit(cmd.TeamID+":"+cmd.UserID, func() { d.DispatchSlashCommand(cmd) })
+}
+
+func (d *Dispatcher) SubmitInteraction(callback slack.InteractionCallback) {
+	d.pool.Submit(callback.Team.ID+":"+callback.User.ID, func() { d.DispatchInteraction(callback) })
+}
+
+// eventUser returns the user who caused the event, or "" for events without one
+func eventUser(payload slackevents.EventsAPIEvent) string {
+	switch ev := payload.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		return ev.User
+	case *slackevents.MessageEvent:
+		return ev.User
+	}
+	return ""
+}
+
+// dedupTTL is how long a delivered ID is remembered. Slack gives up retrying within a few minutes.
+const dedupTTL = 10 * time.Minute
+
+// firstDelivery reports whether the payload with id has not been handled yet.
+// An empty id or a Redis error lets the payload through, since dropping it would lose the user's action.
+func (d *Dispatcher) firstDelivery(kind, id string) bool {
+	if id == "" {
+		return true
+	}
+	first, err := d.workspaces.redisClient.FirstSeen(context.Background(), kind+":"+id, dedupTTL)
+	if err != nil {
+		slog.Error("Failed to check duplicate delivery", slog.String("kind", kind), slog.String("id", id), slog.Any("error", err))
+		return true
+	}
+	if !first {
+		slog.Info("Skipped duplicate delivery", slog.String("kind", kind), slog.String("id", id))
+	}
+	return first
+}
+
+// FirstEnvelope reports whether a socket mode envelope is delivered for the first time
+func (d *Dispatcher) FirstEnvelope(envelopeID string) bool {
+	return d.firstDelivery("envelope", envelopeID)
+}
+
+func (d *Dispatcher) workspace(teamID string) (*workspace, bool) {
+	ws, err := d.workspaces.get(context.Background(), teamID)
+	if err != nil {
+		slog.Error("Failed to resolve workspace", slog.String("team", teamID), slog.Any("error", err))
+		return nil, false
+	}
+	return ws, true
+}
+
+func (d *Dispatcher) DispatchEventsAPI(payload slackevents.EventsAPIEvent) {
+	if payload.Type != slackevents.CallbackEvent {
+		return
+	}
+	if cb, ok := payload.Data.(*slackevents.EventsAPICallbackEvent); ok && !d.firstDelivery("event", cb.EventID) {
+		return
+	}
+
+	innerEvent := payload.InnerEvent
+	if _, ok := innerEvent.Data.(*slackevents.AppUninstalledEvent); ok {
+		slog.Info("App uninstalled", slog.String("team", payload.TeamID))
+		if err := d.workspaces.Uninstall(context.Background(), payload.TeamID); err != nil {
+			slog.Error("Failed to delete installation", slog.String("team", payload.TeamID), slog.Any("error", err))
+		}
+		return
+	}
+
+	ws, ok := d.workspace(payload.TeamID)
+	if !ok {
+		return
+	}
+	switch ev := innerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		if err := ws.eventHandler.HandleMention(ev); err != nil {
+			slog.Error("Failed to handle mention", slog.Any("error", err))
+		}
+	case *slackevents.MessageEvent:
+		if err := ws.eventHandler.HandleMessage(ev); err != nil {
+			slog.Error("Failed to handle message", slog.Any("error", err))
+		}
+	}
+}
+
+func (d *Dispatcher) DispatchSlashCommand(cmd slack.SlashCommand) {
+	if !d.firstDelivery("trigger", cmd.TriggerID) {
+		return
+	}
+	ws, ok := d.workspace(cmd.TeamID)
+	if !ok {
+		return
+	}
+	ws.commandHandler.Handle(cmd)
+}
+
+func (d *Dispatcher) DispatchInteraction(callback slack.InteractionCallback) {
+	if !d.firstDelivery("trigger", callback.TriggerID) {
+		return
+	}
+	slog.Info("Received interaction", slog.String("type", string(callback.Type)), slog.String("team", callback.Team.ID), slog.String("user", callback.User.ID))
+	if callback.Type != slack.InteractionTypeViewSubmission {
+		return
+	}
+	ws, ok := d.workspace(callback.Team.ID)
+	if !ok {
+		return
+	}
+	ws.commandHandler.HandleViewSubmission(callback)
+}
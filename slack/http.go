@@ -0,0 +1,153 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// maxBodySize limits request bodies read before the signature is verified
+const maxBodySize = 1 << 20
+
+// Routes registers handlers on the mux of the HTTP server
+type Routes func(mux *http.ServeMux)
+
+// shutdownTimeout bounds how long in-flight requests may take once the server is stopping
+const shutdownTimeout = 10 * time.Second
+
+// StartHTTPServer serves the given routes, /healthz and the /debug/vars metrics until ctx is done.
+// It then stops accepting connections, lets in-flight requests finish, and returns nil.
+func StartHTTPServer(ctx context.Context, addr string, routes ...Routes) error {
+	mux := http.NewServeMux()
+	for _, r := range routes {
+		r(mux)
+	}
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down HTTP server", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("Listening for HTTP requests", slog.String("addr", addr))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// EventRoutes serves the Events API, slash commands and interactivity over HTTPS
+// instead of socket mode. Every request must carry a valid X-Slack-Signature.
+//
+//	POST /slack/events         Events API
+//	POST /slack/commands       slash commands
+//	POST /slack/interactivity  interactivity payloads
+func EventRoutes(signingSecret string, dispatcher *Dispatcher) Routes {
+	return func(mux *http.ServeMux) {
+		eventRoutes(mux, signingSecret, dispatcher)
+	}
+}
+
+func eventRoutes(mux *http.ServeMux, signingSecret string, dispatcher *Dispatcher) {
+	mux.HandleFunc("/slack/events", verified(signingSecret, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			slog.Error("Failed to parse event", slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if event.Type == slackevents.URLVerification {
+			var challenge slackevents.ChallengeResponse
+			if err := json.Unmarshal(body, &challenge); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(challenge.Challenge))
+			return
+		}
+
+		// Slack expects a response within 3 seconds, so ack before handling
+		w.WriteHeader(http.StatusOK)
+		dispatcher.SubmitEventsAPI(event)
+	}))
+	mux.HandleFunc("/slack/commands", verified(signingSecret, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		cmd, err := slack.SlashCommandParse(r)
+		if err != nil {
+			slog.Error("Failed to parse slash command", slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		dispatcher.SubmitSlashCommand(cmd)
+	}))
+	mux.HandleFunc("/slack/interactivity", verified(signingSecret, func(w http.ResponseWriter, r *http.Request, body []byte) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var callback slack.InteractionCallback
+		if err := json.Unmarshal([]byte(r.PostFormValue("payload")), &callback); err != nil {
+			slog.Error("Failed to parse interaction payload", slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		dispatcher.SubmitInteraction(callback)
+	}))
+}
+
+// verified checks the request signature with the signing secret before calling next.
+// The body is passed to next and also restored on the request so that form parsing still works.
+func verified(signingSecret string, next func(w http.ResponseWriter, r *http.Request, body []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sv, err := slack.NewSecretsVerifier(r.Header, signingSecret)
+		if err != nil {
+			slog.Warn("Rejected unsigned request", slog.String("path", r.URL.Path), slog.Any("error", err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if _, err := sv.Write(body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := sv.Ensure(); err != nil {
+			slog.Warn("Rejected request with invalid signature", slog.String("path", r.URL.Path), slog.Any("error", err))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r, body)
+	}
+}
@@ -0,0 +1,122 @@
+package slack
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+)
+
+// DefaultScopes are the bot scopes the commands and event handlers need
+const DefaultScopes = "app_mentions:read,channels:history,groups:history,channels:read,groups:read,im:history,mpim:history,chat:write,commands,users:read,im:write,files:write"
+
+// oauthStateTTL is how long an install link stays valid
+const oauthStateTTL = 10 * time.Minute
+
+// Installer implements the OAuth v2 install flow and stores the bot token of each team
+//
+//	GET /slack/install         redirects to Slack's authorize page
+//	GET /slack/oauth_redirect  exchanges the code for a bot token
+type Installer struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	redisClient  store.Store
+	workspaces   *Workspaces
+}
+
+// NewInstaller creates an Installer. redirectURL may be empty to use the one registered in the app settings.
+func NewInstaller(clientID, clientSecret, redirectURL, scopes string, redisClient store.Store, workspaces *Workspaces) *Installer {
+	if scopes == "" {
+		scopes = DefaultScopes
+	}
+	return &Installer{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		redisClient:  redisClient,
+		workspaces:   workspaces,
+	}
+}
+
+// Routes registers the install endpoints
+func (i *Installer) Routes(mux *http.ServeMux) {
+	mux.HandleFunc("/slack/install", i.handleInstall)
+	mux.HandleFunc("/slack/oauth_redirect", i.handleRedirect)
+}
+
+func (i *Installer) handleInstall(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "failed to generate state", http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(buf)
+	if err := i.redisClient.SaveOAuthState(r.Context(), state, oauthStateTTL); err != nil {
+		slog.Error("Failed to save OAuth state", slog.Any("error", err))
+		http.Error(w, "failed to start installation", http.StatusInternalServerError)
+		return
+	}
+
+	q := url.Values{
+		"client_id": {i.clientID},
+		"scope":     {i.scopes},
+		"state":     {state},
+	}
+	if i.redirectURL != "" {
+		q.Set("redirect_uri", i.redirectURL)
+	}
+	http.Redirect(w, r, "https://slack.com/oauth/v2/authorize?"+q.Encode(), http.StatusFound)
+}
+
+func (i *Installer) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "installation was cancelled: "+e, http.StatusBadRequest)
+		return
+	}
+
+	valid, err := i.redisClient.ConsumeOAuthState(r.Context(), q.Get("state"))
+	if err != nil {
+		slog.Error("Failed to check OAuth state", slog.Any("error", err))
+		http.Error(w, "failed to complete installation", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid or expired state, please start again from /slack/install", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := slack.GetOAuthV2ResponseContext(r.Context(), limiterFor(""), i.clientID, i.clientSecret, q.Get("code"), i.redirectURL)
+	if err != nil {
+		slog.Error("Failed to exchange OAuth code", slog.Any("error", err))
+		http.Error(w, "failed to complete installation", http.StatusBadGateway)
+		return
+	}
+
+	inst := store.Installation{
+		TeamID:      resp.Team.ID,
+		TeamName:    resp.Team.Name,
+		BotToken:    resp.AccessToken,
+		BotUserID:   resp.BotUserID,
+		InstalledAt: time.Now(),
+	}
+	if err := i.redisClient.SaveInstallation(r.Context(), inst); err != nil {
+		slog.Error("Failed to save installation", slog.String("team", inst.TeamID), slog.Any("error", err))
+		http.Error(w, "failed to complete installation", http.StatusInternalServerError)
+		return
+	}
+	i.workspaces.Forget(inst.TeamID)
+
+	slog.Info("App installed", slog.String("team", inst.TeamID), slog.String("name", inst.TeamName))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s にインストールしました。このウィンドウは閉じてかまいません。\n", inst.TeamName)
+}
@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// queueSize is how many tasks a worker holds before Submit blocks the transport
+const queueSize = 64
+
+// workerPool runs tasks on a fixed number of workers.
+// Tasks with the same key always go to the same worker, so one user's commands run in the order they arrived
+// while other users are handled in parallel.
+type workerPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newWorkerPool(workers int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &workerPool{queues: make([]chan func(), workers)}
+	for i := range p.queues {
+		q := make(chan func(), queueSize)
+		p.queues[i] = q
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for task := range q {
+				run(task)
+			}
+		}()
+	}
+	return p
+}
+
+// run calls task and keeps the worker alive if it panics
+func run(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Recovered from panic in task", slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+		}
+	}()
+	task()
+}
+
+// Submit queues task on the worker for key. It blocks while that worker's queue is full,
+// and drops the task once the pool is closed.
+func (p *workerPool) Submit(key string, task func()) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		slog.Warn("Dropped task after shutdown", slog.String("key", key))
+		return
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	p.queues[h.Sum32()%uint32(len(p.queues))] <- task
+}
+
+// Close stops accepting tasks and waits until the queued ones have run
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, q := range p.queues {
+			close(q)
+		}
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,234 @@
+package slack
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// maxRetries is how many times a call is retried after a rate limit or a transient error
+	maxRetries = 3
+	// maxRetryAfter is the longest Retry-After we wait for; longer ones are returned to the caller
+	maxRetryAfter = 30 * time.Second
+	// retryBase is the first backoff for transient errors. It doubles with each attempt.
+	retryBase = 500 * time.Millisecond
+)
+
+// Per-method counters, published on /debug/vars
+var (
+	apiCalls       = expvar.NewMap("slack_api_calls")
+	apiRetries     = expvar.NewMap("slack_api_retries")
+	apiRateLimited = expvar.NewMap("slack_api_rate_limited")
+	apiFailures    = expvar.NewMap("slack_api_failures")
+)
+
+// apiHTTPClient is the connection pool shared by every Web API client
+var apiHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// nonIdempotent are the methods Slack may have carried out even when the response is a 5xx or never
+// arrives. Retrying them could post twice, so they are only retried after a 429, which Slack did not process.
+var nonIdempotent = map[string]bool{
+	"chat.postMessage":             true,
+	"chat.postEphemeral":           true,
+	"chat.scheduleMessage":         true,
+	"files.upload":                 true,
+	"files.completeUploadExternal": true,
+	"views.open":                   true,
+	"views.push":                   true,
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*rateLimiter{}
+)
+
+// NewAPIClient creates a Web API client whose calls wait out rate limits and retry transient errors.
+// Slack rate limits each workspace separately, so the clients of one token share their gates and
+// a 429 seen by one workspace does not hold back the calls of the others.
+func NewAPIClient(token string, options ...slack.Option) *slack.Client {
+	return slack.New(token, append([]slack.Option{slack.OptionHTTPClient(limiterFor(token))}, options...)...)
+}
+
+// limiterFor returns the rate limiter of a token, creating it on first use.
+// The empty token is used by the calls made without a bot token (socket mode and OAuth).
+func limiterFor(token string) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[token]
+	if !ok {
+		l = newRateLimiter(apiHTTPClient)
+		limiters[token] = l
+	}
+	return l
+}
+
+// rateLimiter sends each Web API request of one token through the gate of its method.
+// When Slack answers 429, the gate of that method stays closed for Retry-After,
+// so the calls queued behind it wait instead of being rate limited too.
+type rateLimiter struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	gates map[string]*gate
+}
+
+func newRateLimiter(client *http.Client) *rateLimiter {
+	return &rateLimiter{
+		client: client,
+		gates:  map[string]*gate{},
+	}
+}
+
+type gate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// wait blocks until the gate opens or ctx is done
+func (g *gate) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		d := time.Until(g.until)
+		g.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+// close keeps the gate closed for d, unless it already is for longer
+func (g *gate) close(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := time.Now().Add(d); until.After(g.until) {
+		g.until = until
+	}
+}
+
+func (l *rateLimiter) gate(method string) *gate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	g, ok := l.gates[method]
+	if !ok {
+		g = &gate{}
+		l.gates[method] = g
+	}
+	return g
+}
+
+// Do implements the HTTP client interface of slack-go
+func (l *rateLimiter) Do(req *http.Request) (*http.Response, error) {
+	method := apiMethod(req.URL.Path)
+	g := l.gate(method)
+	for attempt := 0; ; attempt++ {
+		if err := g.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		apiCalls.Add(method, 1)
+		resp, err := l.client.Do(req)
+		wait, rateLimited, retryable := retryDelay(resp, err, attempt, !nonIdempotent[method])
+		if rateLimited {
+			apiRateLimited.Add(method, 1)
+			g.close(wait)
+		}
+		if !retryable || attempt >= maxRetries || !rewindable(req) {
+			if err != nil || resp.StatusCode >= 400 {
+				apiFailures.Add(method, 1)
+			}
+			return resp, err
+		}
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		apiRetries.Add(method, 1)
+		if rateLimited {
+			slog.Warn("Slack API rate limited, waiting", slog.String("method", method), slog.Duration("retry_after", wait), slog.Int("attempt", attempt+1))
+			continue
+		}
+		slog.Warn("Slack API call failed, retrying", slog.String("method", method), slog.Duration("backoff", wait), slog.Int("attempt", attempt+1), slog.Int("status", status), slog.Any("error", err))
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay decides whether a response is worth retrying and how long to wait first.
+// 429 waits for Retry-After plus a little jitter so the queued calls don't all fire at once;
+// 5xx and network errors back off exponentially with jitter, but only for idempotent methods.
+// It returns the wait, whether the call was rate limited, and whether to retry.
+func retryDelay(resp *http.Response, err error, attempt int, idempotent bool) (time.Duration, bool, bool) {
+	if err != nil {
+		if !idempotent || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false, false
+		}
+		return backoff(attempt), false, true
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err != nil {
+			secs = 1
+		}
+		wait := time.Duration(secs) * time.Second
+		if wait > maxRetryAfter {
+			return wait, true, false
+		}
+		return wait + time.Duration(rand.Int63n(int64(time.Second))), true, true
+	case resp.StatusCode >= 500 && idempotent:
+		return backoff(attempt), false, true
+	}
+	return 0, false, false
+}
+
+// backoff returns a random duration between half and all of retryBase * 2^attempt
+func backoff(attempt int) time.Duration {
+	d := retryBase << attempt
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// rewindable reports whether the request body can be sent again. Streamed uploads can't.
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// apiMethod returns "chat.postMessage" for "/api/chat.postMessage"
+func apiMethod(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
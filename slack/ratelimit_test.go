@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// testAPI serves the Web API methods with handle and counts the calls of each method
+func testAPI(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, call int)) (string, func(method string) int) {
+	t.Helper()
+	var (
+		mu    sync.Mutex
+		calls = map[string]int{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		key := apiMethod(r.URL.Path) + "/" + r.Form.Get("token")
+		mu.Lock()
+		calls[key]++
+		n := calls[key]
+		mu.Unlock()
+		handle(w, r, n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/api/", func(key string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[key]
+	}
+}
+
+func testClient(url, token string) *slack.Client {
+	return NewAPIClient(token, slack.OptionAPIURL(url))
+}
+
+func TestRateLimitIsPerToken(t *testing.T) {
+	url, _ := testAPI(t, func(w http.ResponseWriter, r *http.Request, call int) {
+		if r.Form.Get("token") == "xoxb-limited" && call == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0"}`))
+	})
+
+	limited := make(chan error, 1)
+	go func() {
+		_, _, err := testClient(url, "xoxb-limited").PostMessage("C1", slack.MsgOptionText("a", false))
+		limited <- err
+	}()
+	// the gate of the rate limited token stays closed while it waits
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	if _, _, err := testClient(url, "xoxb-other").PostMessage("C1", slack.MsgOptionText("b", false)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("another workspace waited %v for the rate limit", d)
+	}
+	if err := <-limited; err != nil {
+		t.Errorf("rate limited call: %v", err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		call   func(c *slack.Client) error
+		method string
+		want   int
+	}{
+		{
+			name:   "post is not retried after 5xx",
+			status: http.StatusInternalServerError,
+			call: func(c *slack.Client) error {
+				_, _, err := c.PostMessage("C1", slack.MsgOptionText("a", false))
+				return err
+			},
+			method: "chat.postMessage",
+			want:   1,
+		},
+		{
+			name:   "post is retried after 429",
+			status: http.StatusTooManyRequests,
+			call: func(c *slack.Client) error {
+				_, _, err := c.PostMessage("C1", slack.MsgOptionText("a", false))
+				return err
+			},
+			method: "chat.postMessage",
+			want:   2,
+		},
+		{
+			name:   "read is retried after 5xx",
+			status: http.StatusBadGateway,
+			call: func(c *slack.Client) error {
+				_, err := c.GetUserInfo("U1")
+				return err
+			},
+			method: "users.info",
+			want:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := "xoxb-" + tt.name
+			url, calls := testAPI(t, func(w http.ResponseWriter, r *http.Request, call int) {
+				if call == 1 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(tt.status)
+					return
+				}
+				_, _ = w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1.0","user":{"id":"U1"}}`))
+			})
+			err := tt.call(testClient(url, token))
+			if got := calls(tt.method + "/" + token); got != tt.want {
+				t.Errorf("%s was called %d times, want %d (err: %v)", tt.method, got, tt.want, err)
+			}
+			if tt.want == 1 && err == nil {
+				t.Error("the failed post returned no error")
+			}
+		})
+	}
+}
@@ -1,29 +1,32 @@
 package slack
 
 import (
-	"log/slog"
-	"os"
+	"context"
+	"errors"
 
-	"github.com/pyama86/slack-afk/go/handlers"
-	"github.com/pyama86/slack-afk/go/store"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 )
 
-func StartSocketModeServer(redisClient *store.RedisClient) error {
-	api := slack.New(
-		os.Getenv("SLACK_BOT_TOKEN"),
-		slack.OptionAppLevelToken(os.Getenv("SLACK_APP_TOKEN")),
-	)
-
-	client := socketmode.New(api)
-
-	commandHandler := handlers.NewCommandHandler(api, redisClient)
-	eventHandler := handlers.NewEventHandler(api, redisClient)
+// StartSocketModeServer receives the payloads of every workspace over one socket opened with the app-level token.
+// It returns nil once ctx is done; payloads already submitted are left to the dispatcher.
+func StartSocketModeServer(ctx context.Context, appToken string, dispatcher *Dispatcher) error {
+	client := socketmode.New(NewAPIClient("", slack.OptionAppLevelToken(appToken)))
 
 	go func() {
-		for evt := range client.Events {
+		for {
+			var evt socketmode.Event
+			select {
+			case <-ctx.Done():
+				return
+			case evt = <-client.Events:
+			}
+			// Slack resends an envelope that was not acknowledged in time, so handle each one once
+			if evt.Request != nil && !dispatcher.FirstEnvelope(evt.Request.EnvelopeID) {
+				client.Ack(*evt.Request)
+				continue
+			}
 			switch evt.Type {
 			case socketmode.EventTypeEventsAPI:
 				client.Ack(*evt.Request)
@@ -31,31 +34,28 @@ func StartSocketModeServer(redisClient *store.RedisClient) error {
 				if !ok {
 					continue
 				}
-
-				switch payload.Type {
-				case slackevents.CallbackEvent:
-					innerEvent := payload.InnerEvent
-					switch ev := innerEvent.Data.(type) {
-					case *slackevents.AppMentionEvent:
-						if err := eventHandler.HandleMention(ev); err != nil {
-							slog.Error("Failed to handle mention", slog.Any("error", err))
-						}
-					case *slackevents.MessageEvent:
-						if err := eventHandler.HandleMessage(ev); err != nil {
-							slog.Error("Failed to handle message", slog.Any("error", err))
-						}
-					}
-				}
+				dispatcher.SubmitEventsAPI(payload)
 			case socketmode.EventTypeSlashCommand:
 				client.Ack(*evt.Request)
 				cmd, ok := evt.Data.(slack.SlashCommand)
 				if !ok {
 					continue
 				}
-				commandHandler.Handle(cmd)
+				dispatcher.SubmitSlashCommand(cmd)
+			case socketmode.EventTypeInteractive:
+				client.Ack(*evt.Request)
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					continue
+				}
+				dispatcher.SubmitInteraction(callback)
 			}
 		}
 	}()
 
-	return client.Run()
+	err := client.RunContext(ctx)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,63 @@
+package slack
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// standupDedupTTL keeps the mark of a posted digest past the next run
+const standupDedupTTL = 24 * time.Hour
+
+// RunStandupDigest posts the standup digest of the team of SLACK_BOT_TOKEN to channelID
+// every weekday at hour:minute (JST) until ctx is done.
+// Replicas sharing the store post each digest once: only the first to mark the day posts it.
+func (w *Workspaces) RunStandupDigest(ctx context.Context, hour, minute int, channelID string) {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	for {
+		now := time.Now().In(jst)
+		next := nextStandup(now, hour, minute)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		w.postStandupDigest(ctx, channelID, next)
+	}
+}
+
+// nextStandup returns the first weekday hour:minute after now
+func nextStandup(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	for next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (w *Workspaces) postStandupDigest(ctx context.Context, channelID string, at time.Time) {
+	// A store error lets the digest through, like a duplicate delivery check
+	first, err := w.redisClient.FirstSeen(ctx, "standup:"+w.defaultTeamID+":"+at.Format("2006-01-02"), standupDedupTTL)
+	if err != nil {
+		slog.Error("Failed to check standup digest", slog.Any("error", err))
+	} else if !first {
+		slog.Info("Standup digest already posted", slog.String("date", at.Format("2006-01-02")))
+		return
+	}
+
+	ws, err := w.get(ctx, w.defaultTeamID)
+	if err != nil {
+		slog.Error("Failed to resolve workspace", slog.String("team", w.defaultTeamID), slog.Any("error", err))
+		return
+	}
+	if err := ws.commandHandler.PostStandupDigest(channelID, at); err != nil {
+		slog.Error("Failed to post standup digest", slog.Any("error", err))
+		return
+	}
+	slog.Info("Posted standup digest", slog.String("channel", channelID), slog.String("date", at.Format("2006-01-02")))
+}
@@ -0,0 +1,143 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/pyama86/slack-afk/go/audit"
+	"github.com/pyama86/slack-afk/go/handlers"
+	"github.com/pyama86/slack-afk/go/spreadsheet"
+	"github.com/pyama86/slack-afk/go/store"
+	"github.com/slack-go/slack"
+	"golang.org/x/sync/singleflight"
+)
+
+// workspace is the Slack client, store and handlers bound to one team
+type workspace struct {
+	client         *slack.Client
+	commandHandler *handlers.CommandHandler
+	eventHandler   *handlers.EventHandler
+}
+
+func (w *Workspaces) newWorkspace(teamID string, client *slack.Client, attendance *spreadsheet.Client) *workspace {
+	redisClient := w.redisClient.ForTeam(teamID)
+	backend := w.auditBackend
+	if backend == nil {
+		backend = audit.NewStoreBackend(redisClient)
+	}
+	auditLog := audit.NewLogger(backend, teamID)
+	return &workspace{
+		client:         client,
+		commandHandler: handlers.NewCommandHandler(client, redisClient, attendance, auditLog),
+		eventHandler:   handlers.NewEventHandler(client, redisClient, auditLog),
+	}
+}
+
+// Workspaces resolves the workspace of a team ID.
+// The team of SLACK_BOT_TOKEN is registered up front; other teams are built on first use
+// from the bot token stored by the OAuth install flow and cached.
+type Workspaces struct {
+	redisClient   store.Store
+	defaultTeamID string
+	auditBackend  audit.Backend // nil: the store of each team
+
+	mu     sync.Mutex
+	teams  map[string]*workspace
+	forgot map[string]int // how often each team was forgotten, so that a build started before is not cached
+
+	// builds makes the concurrent first events of a team wait for one build of its workspace.
+	// The build reads the store and the spreadsheet without holding mu, so other teams are not held up.
+	builds singleflight.Group
+}
+
+// NewWorkspaces creates the registry. When api is not nil it serves defaultTeamID with attendance.
+// Audit entries go to auditBackend, or to the store of each team when it is nil.
+func NewWorkspaces(redisClient store.Store, api *slack.Client, defaultTeamID string, attendance *spreadsheet.Client, auditBackend audit.Backend) *Workspaces {
+	w := &Workspaces{
+		redisClient:   redisClient,
+		defaultTeamID: defaultTeamID,
+		auditBackend:  auditBackend,
+		teams:         map[string]*workspace{},
+		forgot:        map[string]int{},
+	}
+	if api != nil {
+		w.teams[defaultTeamID] = w.newWorkspace(defaultTeamID, api, attendance)
+	}
+	return w
+}
+
+func (w *Workspaces) get(ctx context.Context, teamID string) (*workspace, error) {
+	w.mu.Lock()
+	ws, ok := w.teams[teamID]
+	w.mu.Unlock()
+	if ok {
+		return ws, nil
+	}
+
+	v, err, _ := w.builds.Do(teamID, func() (interface{}, error) {
+		w.mu.Lock()
+		forgot := w.forgot[teamID]
+		w.mu.Unlock()
+
+		// the build is shared, so one caller giving up must not fail the others
+		ws, err := w.build(context.WithoutCancel(ctx), teamID)
+		if err != nil {
+			return nil, err
+		}
+		w.mu.Lock()
+		if w.forgot[teamID] == forgot {
+			w.teams[teamID] = ws
+		}
+		w.mu.Unlock()
+		return ws, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*workspace), nil
+}
+
+// build creates the workspace of a team from its stored installation
+func (w *Workspaces) build(ctx context.Context, teamID string) (*workspace, error) {
+	inst, err := w.redisClient.GetInstallation(ctx, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load installation of %s: %w", teamID, err)
+	}
+	if inst == nil {
+		return nil, fmt.Errorf("team %s has not installed the app", teamID)
+	}
+	client := NewAPIClient(inst.BotToken)
+
+	var attendance *spreadsheet.Client
+	if id := spreadsheet.SpreadsheetID(teamID, w.defaultTeamID); id != "" {
+		attendance, err = spreadsheet.NewClient(ctx, client, w.redisClient, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize attendance client of %s for %s: %w", teamID, id, err)
+		}
+	}
+
+	ws := w.newWorkspace(teamID, client, attendance)
+	slog.Info("Loaded workspace", slog.String("team", teamID), slog.String("name", inst.TeamName), slog.Bool("attendance", attendance != nil))
+	return ws, nil
+}
+
+// Forget drops the cached workspace of a team so that it is rebuilt from the stored installation.
+// The team of SLACK_BOT_TOKEN keeps using the token from the environment.
+func (w *Workspaces) Forget(teamID string) {
+	if teamID == w.defaultTeamID {
+		return
+	}
+	w.mu.Lock()
+	delete(w.teams, teamID)
+	w.forgot[teamID]++
+	w.mu.Unlock()
+}
+
+// Uninstall forgets the bot token of a team that removed the app.
+// Its presence data and attendance records are kept.
+func (w *Workspaces) Uninstall(ctx context.Context, teamID string) error {
+	w.Forget(teamID)
+	return w.redisClient.DeleteInstallation(ctx, teamID)
+}
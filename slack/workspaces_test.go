@@ -0,0 +1,130 @@
+package slack
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/store"
+)
+
+// slowInstallations holds GetInstallation until release is closed, and counts the calls
+type slowInstallations struct {
+	store.Store
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *slowInstallations) GetInstallation(ctx context.Context, teamID string) (*store.Installation, error) {
+	s.calls.Add(1)
+	<-s.release
+	return s.Store.GetInstallation(ctx, teamID)
+}
+
+func TestWorkspacesBuildOncePerTeam(t *testing.T) {
+	db, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "afk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	if err := db.SaveInstallation(ctx, store.Installation{TeamID: "T0002", BotToken: "xoxb-2"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &slowInstallations{Store: db, release: make(chan struct{})}
+	w := NewWorkspaces(s, NewAPIClient("xoxb-1"), "T0001", nil, nil)
+
+	const callers = 10
+	var (
+		wg  sync.WaitGroup
+		got [callers]*workspace
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ws, err := w.get(ctx, "T0002")
+			if err != nil {
+				t.Error(err)
+			}
+			got[i] = ws
+		}(i)
+	}
+
+	// while T0002 is being built, the cached team is served without waiting
+	deadline := time.Now().Add(time.Second)
+	for s.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	served := make(chan error, 1)
+	go func() {
+		_, err := w.get(ctx, "T0001")
+		served <- err
+	}()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the default team waited for another team's build")
+	}
+
+	close(s.release)
+	wg.Wait()
+	if n := s.calls.Load(); n != 1 {
+		t.Errorf("GetInstallation was called %d times, want 1", n)
+	}
+	for i := range got {
+		if got[i] == nil || got[i] != got[0] {
+			t.Fatalf("callers got different workspaces")
+		}
+	}
+	if ws, err := w.get(ctx, "T0002"); err != nil || ws != got[0] {
+		t.Errorf("workspace was not cached: %v", err)
+	}
+}
+
+func TestWorkspacesForgetDuringBuild(t *testing.T) {
+	db, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "afk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ctx := context.Background()
+	if err := db.SaveInstallation(ctx, store.Installation{TeamID: "T0002", BotToken: "xoxb-2"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &slowInstallations{Store: db, release: make(chan struct{})}
+	w := NewWorkspaces(s, nil, "T0001", nil, nil)
+
+	built := make(chan *workspace, 1)
+	go func() {
+		ws, err := w.get(ctx, "T0002")
+		if err != nil {
+			t.Error(err)
+		}
+		built <- ws
+	}()
+	deadline := time.Now().Add(time.Second)
+	for s.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	w.Forget("T0002")
+	close(s.release)
+	first := <-built
+
+	second, err := w.get(ctx, "T0002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("the workspace built before Forget was cached")
+	}
+	if n := s.calls.Load(); n != 2 {
+		t.Errorf("GetInstallation was called %d times, want 2", n)
+	}
+}
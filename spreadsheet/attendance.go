@@ -2,430 +2,485 @@ package spreadsheet
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
-	"time"
 	"strings"
-	"strconv"
+	"sync"
+	"time"
 
+	"github.com/slack-go/slack"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
-	"golang.org/x/oauth2/google"
-	"github.com/slack-go/slack"
 )
 
 const (
-	spreadsheetIDEnv = "ATTENDANCE_SPREADSHEET_ID" // スプレッドシートIDは環境変数で指定
+	spreadsheetIDEnv  = "ATTENDANCE_SPREADSHEET_ID"  // スプレッドシートIDは環境変数で指定
+	spreadsheetIDsEnv = "ATTENDANCE_SPREADSHEET_IDS" // ワークスペースごとのスプレッドシートID（"T0123:ID,T0456:ID"）
+	sheetsEndpointEnv = "ATTENDANCE_SHEETS_ENDPOINT" // Sheets APIのエンドポイント（テスト用の偽サーバーなど）
 )
 
+// SpreadsheetID はワークスペースの勤怠スプレッドシートIDを返す（未設定なら空）
+// ATTENDANCE_SPREADSHEET_IDS に載っていなければ、SLACK_BOT_TOKEN のワークスペース（defaultTeamID）に限り
+// ATTENDANCE_SPREADSHEET_ID を使う。別のワークスペースの記録が混ざらないよう、他のワークスペースには使わない
+func SpreadsheetID(teamID, defaultTeamID string) string {
+	for _, pair := range strings.Split(os.Getenv(spreadsheetIDsEnv), ",") {
+		team, id, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && team == teamID && id != "" {
+			return id
+		}
+	}
+	if teamID == defaultTeamID {
+		return os.Getenv(spreadsheetIDEnv)
+	}
+	return ""
+}
+
 // 勤怠種別
+// 離席・外出などの状態の種別はステータスカタログ（catalog パッケージ）で決まる
 const (
-	TypeStart  = "出勤"
-	TypeFinish = "退勤"
-	TypeLunch  = "外出"
-	TypeAfk    = "離席"
+	TypeStart    = "出勤"
+	TypeFinish   = "退勤"
 	TypeComeback = "復帰"
-	TypeCancel = "取消"
+	TypeCancel   = "取消"
 )
 
+// recordClaimTTL は記録IDの確保を保つ時間。書き込み中に落ちても、この時間が過ぎれば再送で書き直せる
+const recordClaimTTL = 10 * time.Minute
+
+// sheetLockTTL はユーザーのシートのロックを保つ時間。ロック中に落ちても、この時間が過ぎれば解ける
+const sheetLockTTL = 5 * time.Minute
+
+// sheetLockWait はほかの処理のロックが解けるのを待つ上限
+const sheetLockWait = 30 * time.Second
+
+// errSheetBusy はユーザーのシートがほかの処理（シートの統合など）でロックされたままのときのエラー
+var errSheetBusy = errors.New("シートを統合中です。しばらくしてからやり直してください")
+
+// errRecordInProgress は同じ記録IDの書き込みが別の処理でまだ終わっていないときのエラー
+var errRecordInProgress = errors.New("同じ記録IDの書き込みが処理中です")
+
+// Claims は記録IDを確保する先（store.Store が満たす）
+// FirstSeen が true を返した処理だけがその記録IDの行を書き込み、失敗したら ForgetSeen で確保を解く
+// ユーザーのシートのロック（lockUser）にも使う
+type Claims interface {
+	FirstSeen(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	ForgetSeen(ctx context.Context, id string) error
+}
+
+var header = []interface{}{"日付", "時刻", "種別", "メッセージ", "実働時間（h:mm）", "記録ID", "勤務地", "日報"}
+
+// Client は勤怠スプレッドシートへのアクセスをまとめたクライアント
+// 起動時に一度だけ生成し、Sheets APIクライアント・シート一覧・ユーザー→シートの対応をキャッシュする
+type Client struct {
+	srv         *sheets.Service
+	slackClient *slack.Client
+	claims      Claims // nil なら記録IDを確保せず、シートの確認だけで重複を防ぐ
+	layout      Layout
+	root        *book // ATTENDANCE_SPREADSHEET_ID のスプレッドシート
+
+	mu      sync.Mutex
+	periods map[string]string // 期間 → 月別スプレッドシートID（nilなら未取得）
+	books   map[string]*book  // 期間 → 月別スプレッドシート
+
+	periodMu sync.Mutex // 月別スプレッドシートの作成を直列化する
+
+	lockMu    sync.Mutex
+	userLocks map[string]*sync.Mutex // ユーザーID → そのユーザーのシートへの書き込みのロック
+}
+
+// NewClient はスプレッドシートIDとGoogle認証情報から勤怠クライアントを生成する
+// slackClient は記録するワークスペースのもの（シート名に使う表示名の取得に使う）
+// claims は記録IDとシートのロックの確保先（nil ならロックはプロセス内だけ）
+// 認証情報が使えない、またはスプレッドシートにアクセスできない場合はエラーを返す
+func NewClient(ctx context.Context, slackClient *slack.Client, claims Claims, spreadsheetID string) (*Client, error) {
+	if spreadsheetID == "" {
+		return nil, fmt.Errorf("スプレッドシートIDが未設定です（%s または %s）", spreadsheetIDEnv, spreadsheetIDsEnv)
+	}
+	layout, err := layoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		opts   []option.ClientOption
+		source string
+	)
+	if endpoint := os.Getenv(sheetsEndpointEnv); endpoint != "" {
+		// CIなどで偽のSheets APIに向けるときは認証しない
+		opts = append(opts, option.WithEndpoint(endpoint), option.WithoutAuthentication())
+		source = endpoint
+	} else {
+		creds, src, err := loadCredentials()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := creds.TokenSource.Token(); err != nil {
+			return nil, fmt.Errorf("Google認証情報（%s）でアクセストークンを取得できません: %w", src, err)
+		}
+		opts = append(opts, option.WithCredentials(creds))
+		source = src
+	}
+	srv, err := sheets.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Sheets APIクライアント生成失敗: %w", err)
+	}
+
+	c := &Client{
+		srv:         srv,
+		slackClient: slackClient,
+		claims:      claims,
+		layout:      layout,
+		root:        newBook(srv, spreadsheetID),
+		books:       map[string]*book{},
+		userLocks:   map[string]*sync.Mutex{},
+	}
+	// 確認ついでにシート一覧のキャッシュを作っておく
+	if err := c.root.refreshSheets(ctx); err != nil {
+		return nil, fmt.Errorf("スプレッドシート %s にアクセスできません（%s）: %w", spreadsheetID, source, err)
+	}
+	slog.Info("Attendance spreadsheet enabled", slog.String("credentials", source), slog.String("layout", string(layout)))
+	return c, nil
+}
+
 // 勤怠レコード
 // messageは任意
+// recordID は操作ごとに一意なID（空なら確認しない）。同じIDの行がすでにあれば追加せずその行番号を返すので、
+// Slackの再送などで同じ操作が繰り返されても行が重複しない（appendOnce を参照）
 // 追加した行番号（1-indexed）を返す
-func AppendAttendanceRecord(slackClient *slack.Client, userID, recordType, message string) (int, error) {
-	ctx := context.Background()
+func (c *Client) AppendAttendanceRecord(ctx context.Context, userID, recordType, message, recordID string) (int, error) {
+	rowNum, _, err := c.appendNow(ctx, userID, Record{Type: recordType, Message: message, ID: recordID})
+	return rowNum, err
+}
 
-	spreadsheetID := os.Getenv(spreadsheetIDEnv)
-	if spreadsheetID == "" {
-		return 0, fmt.Errorf("環境変数 %s が未設定です", spreadsheetIDEnv)
-	}
+// AppendFinishRecord は日報（空ならなし）付きの退勤行を追加する
+// recordID と行番号の扱いは AppendAttendanceRecord と同じ
+// 記録した時刻も返すので、UpdateActualWorkTime にそのまま渡す
+func (c *Client) AppendFinishRecord(ctx context.Context, userID, message, report, recordID string) (int, time.Time, error) {
+	return c.appendNow(ctx, userID, Record{Type: TypeFinish, Message: message, ID: recordID, Report: report})
+}
+
+// AppendStartRecord は勤務地（空なら指定なし）付きの出勤行を追加する。今日の予定はメッセージ欄に入れる
+// recordID と戻り値の扱いは AppendAttendanceRecord と同じ
+func (c *Client) AppendStartRecord(ctx context.Context, userID, location, plan, recordID string) (int, error) {
+	rowNum, _, err := c.appendNow(ctx, userID, Record{Type: TypeStart, Message: plan, ID: recordID, Location: location})
+	return rowNum, err
+}
 
-	// Google Sheets API認証
-	b, err := os.ReadFile("credentials.json")
+// appendNow は現在時刻の記録として row を追加し、行番号と記録した時刻を返す
+// 同じ記録IDの行がすでにあれば、その行は記録した時刻と同じ期間のシートにある
+func (c *Client) appendNow(ctx context.Context, userID string, row Record) (int, time.Time, error) {
+	now := nowJST()
+	unlock, err := c.lockUser(ctx, userID)
 	if err != nil {
-		return 0, fmt.Errorf("credentials.jsonの読み込みに失敗: %w", err)
+		return 0, now, err
 	}
-	config, err := google.JWTConfigFromJSON(b, sheets.SpreadsheetsScope)
+	defer unlock()
+	s, _, err := c.userSheet(ctx, userID, c.periodOf(now), true)
 	if err != nil {
-		return 0, fmt.Errorf("Google認証情報のパースに失敗: %w", err)
+		return 0, now, err
+	}
+	row.Date = now.Format("2006-01-02")
+	row.Time = now.Format("15:04:05")
+	rowNum, _, err := c.appendOnce(ctx, s, row)
+	return rowNum, now, err
+}
+
+// appendOnce は記録IDの行がまだなければ row を追加し、その行番号と追加したかどうかを返す
+// 冪等性は store に確保する記録IDに頼っている。シートを確認してから追加するまでの間に同じIDの再送が来ても、
+// 確保できた方だけが追加し、もう一方は書き込み済みの行を返す（まだ書き込み中なら errRecordInProgress）
+// 追加に失敗したら確保を解き、再送で書き直せるようにする
+func (c *Client) appendOnce(ctx context.Context, s sheet, row Record) (int, bool, error) {
+	if rowNum, err := s.findRecordID(ctx, row.ID); err != nil || rowNum > 0 {
+		return rowNum, false, err
+	}
+	claimed, err := c.claimRecord(ctx, row.ID)
+	if err != nil {
+		return 0, false, err
+	}
+	if !claimed {
+		rowNum, err := s.findRecordID(ctx, row.ID)
+		if err == nil && rowNum == 0 {
+			err = errRecordInProgress
+		}
+		return rowNum, false, err
 	}
-	ts := config.TokenSource(ctx)
-	srv, err := sheets.NewService(ctx, option.WithTokenSource(ts))
+
+	rowNum, err := s.appendRow(ctx, row.values())
 	if err != nil {
-		return 0, fmt.Errorf("Sheets APIクライアント生成失敗: %w", err)
+		c.releaseRecord(row.ID)
+		s.book.invalidate()
+		return 0, false, fmt.Errorf("勤怠レコード追加失敗: %w", err)
 	}
+	return rowNum, true, nil
+}
 
-	// Slackユーザー情報取得
-	profile, err := slackClient.GetUserProfile(&slack.GetUserProfileParameters{UserID: userID})
+// claimRecord は記録IDを store に確保し、この処理が書き込んでよければ true を返す
+// 記録IDが空か、確保先がなければ常に true
+func (c *Client) claimRecord(ctx context.Context, id string) (bool, error) {
+	if id == "" || c.claims == nil {
+		return true, nil
+	}
+	claimed, err := c.claims.FirstSeen(ctx, "record:"+id, recordClaimTTL)
 	if err != nil {
-		return 0, fmt.Errorf("Slackユーザープロフィール取得失敗: %w", err)
+		return false, fmt.Errorf("記録ID確保失敗: %w", err)
 	}
-	sheetName := profile.FirstName + profile.LastName
-	if sheetName == "" {
-		sheetName = profile.RealName // fallback
+	return claimed, nil
+}
+
+// releaseRecord は書き込めなかった記録IDの確保を解く
+func (c *Client) releaseRecord(id string) {
+	if id == "" || c.claims == nil {
+		return
 	}
-	if sheetName == "" {
-		sheetName = userID // fallback
+	if err := c.claims.ForgetSeen(context.Background(), "record:"+id); err != nil {
+		slog.Error("Failed to release attendance record ID", slog.String("id", id), slog.Any("error", err))
 	}
+}
 
-	// 日付・時刻
-	jst, _ := time.LoadLocation("Asia/Tokyo")
-	now := time.Now().In(jst)
-	dateStr := now.Format("2006-01-02")
-	timeStr := now.Format("15:04:05")
+// lockUser はユーザーのシートへの書き込みを直列化し、ロックを解く関数を返す
+// MergeSheets はシートを読んでから並べ直して書き戻すので、その間に追加・取消された行が失われないようにする
+// プロセス内はミューテックスで、serve と migrate の間は store の確保で直列化する（確保先がなければプロセス内だけ）
+func (c *Client) lockUser(ctx context.Context, userID string) (func(), error) {
+	c.lockMu.Lock()
+	m, ok := c.userLocks[userID]
+	if !ok {
+		m = &sync.Mutex{}
+		c.userLocks[userID] = m
+	}
+	c.lockMu.Unlock()
 
-	// シート存在確認＆なければ作成
-	exists, err := sheetExists(srv, spreadsheetID, sheetName)
+	m.Lock()
+	if c.claims == nil {
+		return m.Unlock, nil
+	}
+	key := "sheet:" + userID
+	deadline := time.Now().Add(sheetLockWait)
+	for {
+		claimed, err := c.claims.FirstSeen(ctx, key, sheetLockTTL)
+		if err != nil {
+			m.Unlock()
+			return nil, fmt.Errorf("シートのロック失敗: %w", err)
+		}
+		if claimed {
+			break
+		}
+		if time.Now().After(deadline) {
+			m.Unlock()
+			return nil, errSheetBusy
+		}
+		select {
+		case <-ctx.Done():
+			m.Unlock()
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return func() {
+		if err := c.claims.ForgetSeen(context.Background(), key); err != nil {
+			slog.Error("Failed to unlock attendance sheet", slog.String("user", userID), slog.Any("error", err))
+		}
+		m.Unlock()
+	}, nil
+}
+
+// AppendRecordAt は指定日時の記録を追加し、その日の実働時間と集計シートの行を更新する
+// 管理者が打刻漏れを後から補うときに使う。追加した行番号（1-indexed）を返す
+// recordID の扱いは AppendAttendanceRecord と同じ
+func (c *Client) AppendRecordAt(ctx context.Context, userID, recordType, message, recordID string, at time.Time) (int, error) {
+	unlock, err := c.lockUser(ctx, userID)
 	if err != nil {
 		return 0, err
 	}
-	if !exists {
-		if err := createSheet(srv, spreadsheetID, sheetName); err != nil {
-			return 0, err
-		}
-		// ヘッダー行追加
-		header := []interface{}{ "日付", "時刻", "種別", "メッセージ", "実働時間（h:mm）" }
-		vr := &sheets.ValueRange{ Values: [][]interface{}{ header } }
-		_, err := srv.Spreadsheets.Values.Append(spreadsheetID, sheetName+"!A1", vr).ValueInputOption("RAW").Do()
-		if err != nil {
-			return 0, fmt.Errorf("ヘッダー追加失敗: %w", err)
-		}
+	defer unlock()
+
+	at = at.In(nowJST().Location())
+	period := c.periodOf(at)
+	s, _, err := c.userSheet(ctx, userID, period, true)
+	if err != nil {
+		return 0, err
+	}
+	date := at.Format("2006-01-02")
+	row := Record{Date: date, Time: at.Format("15:04:05"), Type: recordType, Message: message, ID: recordID}
+	rowNum, added, err := c.appendOnce(ctx, s, row)
+	if err != nil || !added {
+		return rowNum, err
 	}
 
-	// 勤怠レコード追加
-	row := []interface{}{ dateStr, timeStr, recordType, message, "" }
-	vr := &sheets.ValueRange{ Values: [][]interface{}{ row } }
-	respAppend, err := srv.Spreadsheets.Values.Append(spreadsheetID, sheetName+"!A1", vr).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Do()
+	records, err := s.readRecords(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("勤怠レコード追加失敗: %w", err)
-	}
-	// 追加された行番号を推定（APIのレスポンスから）
-	rowNum := 0
-	if respAppend != nil && respAppend.Updates != nil && respAppend.Updates.UpdatedRange != "" {
-		// 例: "シート名!A10:E10" → 10
-		parts := strings.Split(respAppend.Updates.UpdatedRange, "!")
-		if len(parts) == 2 {
-			rowRange := parts[1]
-			rowParts := strings.Split(rowRange, ":")
-			if len(rowParts) == 2 {
-				rowStr := strings.TrimLeft(rowParts[0], "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
-				if n, err := strconv.Atoi(rowStr); err == nil {
-					rowNum = n
-				}
+		return rowNum, err
+	}
+	valid := validRecords(records)
+	// その日の最後の有効な退勤行に実働時間を入れ直す
+	for i := len(valid) - 1; i >= 0; i-- {
+		if valid[i].Date != date || valid[i].Type != TypeFinish {
+			continue
+		}
+		work := ""
+		if d, ok := workTime(valid, date); ok {
+			work = formatDuration(d)
+		}
+		if work != valid[i].WorkTime {
+			if err := s.updateCell(ctx, fmt.Sprintf("E%d", valid[i].Row), work); err != nil {
+				return rowNum, fmt.Errorf("実働時間書き込み失敗: %w", err)
 			}
 		}
+		break
+	}
+	if err := c.updateSummary(ctx, s, userID, period, valid, date); err != nil {
+		slog.Error("Failed to update attendance summary", slog.String("user", userID), slog.Any("error", err))
 	}
 	return rowNum, nil
 }
 
-// 直近の有効な記録を取消し、取消履歴を残す
+// 直近の有効な記録を取消し、取消履歴を残す。取消した日の集計シートの行も更新する
+// reason は取消行のメッセージ欄に書き添える（空なら書かない）
+// 月別レイアウトでは当月と前月のシートだけを見る
+// recordID が同じ取消行がすでにあれば、もう一度取り消さずにその取消の結果を返す
+// appendOnce と同じく、取消行を書く前に記録IDを確保し、取り消せなかったら確保を解く
 // 戻り値: 取消したか, 元の種別, 元のメッセージ, エラー
-func CancelLastRecord(slackClient *slack.Client, userID string) (bool, string, string, error) {
-	ctx := context.Background()
-	spreadsheetID := os.Getenv(spreadsheetIDEnv)
-	if spreadsheetID == "" {
-		return false, "", "", fmt.Errorf("環境変数 %s が未設定です", spreadsheetIDEnv)
-	}
-	b, err := os.ReadFile("credentials.json")
+func (c *Client) CancelLastRecord(ctx context.Context, userID, reason, recordID string) (bool, string, string, error) {
+	now := nowJST()
+	unlock, err := c.lockUser(ctx, userID)
 	if err != nil {
-		return false, "", "", fmt.Errorf("credentials.jsonの読み込みに失敗: %w", err)
+		return false, "", "", err
 	}
-	config, err := google.JWTConfigFromJSON(b, sheets.SpreadsheetsScope)
-	if err != nil {
-		return false, "", "", fmt.Errorf("Google認証情報のパースに失敗: %w", err)
-	}
-	ts := config.TokenSource(ctx)
-	srv, err := sheets.NewService(ctx, option.WithTokenSource(ts))
+	defer unlock()
+
+	claimed, err := c.claimRecord(ctx, recordID)
 	if err != nil {
-		return false, "", "", fmt.Errorf("Sheets APIクライアント生成失敗: %w", err)
+		return false, "", "", err
 	}
-	profile, err := slackClient.GetUserProfile(&slack.GetUserProfileParameters{UserID: userID})
-	if err != nil {
-		return false, "", "", fmt.Errorf("Slackユーザープロフィール取得失敗: %w", err)
+	if !claimed {
+		return c.findCancel(ctx, userID, recordID, now)
 	}
-	sheetName := profile.FirstName + profile.LastName
-	if sheetName == "" {
-		sheetName = profile.RealName
+	cancelled, origType, origMsg, err := c.cancelLast(ctx, userID, reason, recordID, now)
+	if err != nil || !cancelled {
+		c.releaseRecord(recordID)
 	}
-	if sheetName == "" {
-		sheetName = userID
+	return cancelled, origType, origMsg, err
+}
+
+// findCancel は記録IDが recordID の取消行が取り消した記録を探す（同じ取消の再送のとき）
+// 取消行がまだなければ、もう一方の処理が書き込み中なので errRecordInProgress を返す
+func (c *Client) findCancel(ctx context.Context, userID, recordID string, now time.Time) (bool, string, string, error) {
+	for _, period := range c.recentPeriods(now) {
+		s, ok, err := c.userSheet(ctx, userID, period, false)
+		if err != nil {
+			return false, "", "", err
+		}
+		if !ok {
+			continue
+		}
+		records, err := s.readRecords(ctx)
+		if err != nil {
+			return false, "", "", err
+		}
+		if target, ok := cancelledBy(records, recordID); ok {
+			return true, target.Type, target.Message, nil
+		}
 	}
+	return false, "", "", errRecordInProgress
+}
 
-	// シート全データ取得
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, sheetName+"!A:E").Do()
-	if err != nil {
-		return false, "", "", fmt.Errorf("シートデータ取得失敗: %w", err)
-	}
-	if len(resp.Values) < 2 {
-		return false, "", "", nil // データなし
-	}
-	// 直近の有効な記録（取消以外）を探す
-	for i := len(resp.Values) - 1; i >= 1; i-- {
-		row := resp.Values[i]
-		if len(row) < 3 { continue }
-		typ := fmt.Sprint(row[2])
-		if typ == TypeCancel { continue }
-		// 既に取消済みかチェック
-		cancelled := false
-		for j := i + 1; j < len(resp.Values); j++ {
-			if len(resp.Values[j]) < 3 { continue }
-			if fmt.Sprint(resp.Values[j][2]) == TypeCancel && fmt.Sprint(resp.Values[j][3]) == fmt.Sprintf("%d", i+1) {
-				cancelled = true
-				break
-			}
+// cancelLast は CancelLastRecord の本体。記録IDはすでに確保してある
+func (c *Client) cancelLast(ctx context.Context, userID, reason, recordID string, now time.Time) (bool, string, string, error) {
+	for _, period := range c.recentPeriods(now) {
+		s, ok, err := c.userSheet(ctx, userID, period, false)
+		if err != nil {
+			return false, "", "", err
 		}
-		if cancelled { continue }
-		// 取消
-		origType := typ
-		origMsg := ""
-		if len(row) > 3 { origMsg = fmt.Sprint(row[3]) }
-		// 取消履歴として「取消」種別＋取消対象行番号・種別・時刻をメッセージ欄に記録
-		jst, _ := time.LoadLocation("Asia/Tokyo")
-		now := time.Now().In(jst)
-		dateStr := now.Format("2006-01-02")
-		timeStr := now.Format("15:04:05")
-		cancelMsg := fmt.Sprintf("行%d(%s %s)", i+1, typ, row[1])
-		cancelRow := []interface{}{dateStr, timeStr, TypeCancel, cancelMsg, ""}
-		vr := &sheets.ValueRange{Values: [][]interface{}{cancelRow}}
-		_, err := srv.Spreadsheets.Values.Append(spreadsheetID, sheetName+"!A1", vr).ValueInputOption("RAW").Do()
+		if !ok {
+			continue
+		}
+		records, err := s.readRecords(ctx)
 		if err != nil {
+			return false, "", "", err
+		}
+		if target, ok := cancelledBy(records, recordID); ok {
+			return true, target.Type, target.Message, nil
+		}
+		target, rest, ok := lastValid(records)
+		if !ok {
+			continue
+		}
+
+		// 取消履歴として「取消」種別＋取消対象行番号・種別・時刻をメッセージ欄に記録
+		cancelMsg := fmt.Sprintf("行%d(%s %s)", target.Row, target.Type, target.Time)
+		if reason != "" {
+			cancelMsg += " " + reason
+		}
+		cancelRow := Record{Date: now.Format("2006-01-02"), Time: now.Format("15:04:05"), Type: TypeCancel, Message: cancelMsg, ID: recordID}
+		if _, err := s.appendRow(ctx, cancelRow.values()); err != nil {
 			return false, "", "", fmt.Errorf("取消履歴追加失敗: %w", err)
 		}
+
 		// 退勤行なら実働時間セルをクリア
-		if typ == TypeFinish {
-			cell := fmt.Sprintf("E%d", i+1)
-			_, err := srv.Spreadsheets.Values.Update(spreadsheetID, sheetName+"!"+cell, &sheets.ValueRange{Values: [][]interface{}{{""}}}).ValueInputOption("RAW").Do()
-			if err != nil {
+		if target.Type == TypeFinish {
+			if err := s.updateCell(ctx, fmt.Sprintf("E%d", target.Row), ""); err != nil {
 				return false, "", "", fmt.Errorf("実働時間セルクリア失敗: %w", err)
 			}
 		}
-		return true, origType, origMsg, nil
+		if err := c.updateSummary(ctx, s, userID, period, rest, target.Date); err != nil {
+			slog.Error("Failed to update attendance summary", slog.String("user", userID), slog.Any("error", err))
+		}
+		return true, target.Type, target.Message, nil
 	}
 	return false, "", "", nil // 取消できる記録なし
 }
 
-// /finish時に実働時間を計算して記入
+// /finish時に実働時間を計算して記入し、集計シートも更新する
 // 取消履歴・取消対象は無視して有効な記録のみで計算
-// rowNum: 実働時間を書き込む行番号（1-indexed）。0なら従来通り最新の退勤行を自動判定。
-func UpdateActualWorkTime(slackClient *slack.Client, userID string, rowNum int) error {
-	ctx := context.Background()
-	spreadsheetID := os.Getenv(spreadsheetIDEnv)
-	if spreadsheetID == "" {
-		return fmt.Errorf("環境変数 %s が未設定です", spreadsheetIDEnv)
-	}
-	b, err := os.ReadFile("credentials.json")
+// at: 退勤行を記録した時刻（AppendFinishRecord の戻り値）。その期間のシートを更新するので、
+// 月末の退勤を翌月になってから更新しても前月のシートに書き込む
+// rowNum: 実働時間を書き込む行番号（1-indexed）。0なら最新の有効な退勤行を自動判定。
+func (c *Client) UpdateActualWorkTime(ctx context.Context, userID string, at time.Time, rowNum int) error {
+	unlock, err := c.lockUser(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("credentials.jsonの読み込みに失敗: %w", err)
+		return err
 	}
-	config, err := google.JWTConfigFromJSON(b, sheets.SpreadsheetsScope)
-	if err != nil {
-		return fmt.Errorf("Google認証情報のパースに失敗: %w", err)
-	}
-	ts := config.TokenSource(ctx)
-	srv, err := sheets.NewService(ctx, option.WithTokenSource(ts))
-	if err != nil {
-		return fmt.Errorf("Sheets APIクライアント生成失敗: %w", err)
+	defer unlock()
+
+	period := c.periodOf(at.In(nowJST().Location()))
+	s, ok, err := c.userSheet(ctx, userID, period, false)
+	if err != nil || !ok {
+		return err
 	}
-	profile, err := slackClient.GetUserProfile(&slack.GetUserProfileParameters{UserID: userID})
+	records, err := s.readRecords(ctx)
 	if err != nil {
-		return fmt.Errorf("Slackユーザープロフィール取得失敗: %w", err)
-	}
-	sheetName := profile.FirstName + profile.LastName
-	if sheetName == "" {
-		sheetName = profile.RealName
-	}
-	if sheetName == "" {
-		sheetName = userID
+		return err
 	}
+	valid := validRecords(records)
 
-	// シート全データ取得
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetID, sheetName+"!A:E").Do()
-	if err != nil {
-		return fmt.Errorf("シートデータ取得失敗: %w", err)
-	}
-	if len(resp.Values) < 2 {
-		return nil // データなし
-	}
-	// 取消行・取消対象行を無視して有効な記録だけを抽出
-	cancelledRows := map[int]bool{}
-	for _, row := range resp.Values[1:] {
-		if len(row) < 3 { continue }
-		if fmt.Sprint(row[2]) == TypeCancel {
-			// メッセージ欄に取消対象行番号が入っている
-			if len(row) > 3 {
-				var idx int
-				fmt.Sscanf(fmt.Sprint(row[3]), "%d", &idx)
-				if idx > 0 {
-					cancelledRows[idx-1] = true // 0-indexed
-				}
-			}
+	var finish *Record
+	for i := len(valid) - 1; i >= 0; i-- {
+		if valid[i].Type != TypeFinish {
+			continue
 		}
-	}
-	type rowWithIndex struct {
-	row     []interface{}
-	origIdx int
-}
-var validRows []rowWithIndex
-for i, row := range resp.Values[1:] {
-	if cancelledRows[i] { continue }
-	if len(row) < 3 { continue }
-	if fmt.Sprint(row[2]) == TypeCancel { continue }
-	validRows = append(validRows, rowWithIndex{row, i+1}) // +1: ヘッダー分
-}
-	// 日付ごとに最新の退勤行を探す
-	dateToRows := map[string][]int{}
-	for i, rw := range validRows {
-		row := rw.row
-		if len(row) < 3 { continue }
-		date, typ := fmt.Sprint(row[0]), fmt.Sprint(row[2])
-		if typ == TypeFinish {
-			dateToRows[date] = append(dateToRows[date], i)
-		}
-	}
-	if rowNum > 0 {
-	// 指定された行番号の退勤行だけに実働時間を書き込む
-	idx := rowNum - 2 // 1-indexed, ヘッダー分
-	if idx < 0 || idx >= len(resp.Values)-1 {
-		return nil // 範囲外
-	}
-	row := resp.Values[rowNum-1]
-	if len(row) < 3 || fmt.Sprint(row[2]) != TypeFinish {
-		return nil // 退勤行でなければ何もしない
-	}
-	date := fmt.Sprint(row[0])
-	var (
-		startTime, finishTime time.Time
-		breaks [][2]time.Time
-	)
-	for _, rw := range validRows {
-		r := rw.row
-		if len(r) < 3 { continue }
-		rowDate, t := fmt.Sprint(r[0]), fmt.Sprint(r[2])
-		if rowDate != date { continue }
-		ts, _ := time.ParseInLocation("15:04:05", fmt.Sprint(r[1]), time.Local)
-		ts = time.Date(0,1,1,ts.Hour(),ts.Minute(),ts.Second(),0,time.Local)
-		switch t {
-		case TypeStart:
-			startTime = ts
-		case TypeFinish:
-			finishTime = ts
-		case TypeLunch, TypeAfk:
-			breaks = append(breaks, [2]time.Time{ts, {}})
-		case TypeComeback:
-			if len(breaks) > 0 && breaks[len(breaks)-1][1].IsZero() {
-				breaks[len(breaks)-1][1] = ts
-			}
+		if rowNum > 0 && valid[i].Row != rowNum {
+			continue
 		}
-	}
-	if startTime.IsZero() || finishTime.IsZero() {
-		return nil
-	}
-	var breakDur time.Duration
-	for _, b := range breaks {
-		if !b[0].IsZero() && !b[1].IsZero() {
-			breakDur += b[1].Sub(b[0])
-		}
-	}
-	workDur := finishTime.Sub(startTime) - breakDur
-	if workDur < 0 { workDur = 0 }
-	workStr := fmt.Sprintf("%d:%02d", int(workDur.Hours()), int(workDur.Minutes())%60)
-	cell := fmt.Sprintf("E%d", rowNum)
-	_, err = srv.Spreadsheets.Values.Update(spreadsheetID, sheetName+"!"+cell, &sheets.ValueRange{Values: [][]interface{}{{workStr}}}).ValueInputOption("RAW").Do()
-	if err != nil {
-		return fmt.Errorf("実働時間書き込み失敗: %w", err)
-	}
-	return nil
-}
-// 旧ロジック（rowNum=0時のみ）
-lastFinishIdx := -1
-for i := len(validRows) - 1; i >= 0; i-- {
-	row := validRows[i].row
-	if len(row) < 3 { continue }
-	if fmt.Sprint(row[2]) == TypeFinish {
-		lastFinishIdx = i
+		finish = &valid[i]
 		break
 	}
-}
-if lastFinishIdx == -1 {
-	return nil // 退勤行がなければ何もしない
-}
-// その退勤行の日付で出勤～退勤ペア・休憩を集計
-row := validRows[lastFinishIdx].row
-date := fmt.Sprint(row[0])
-var (
-	startTime, finishTime time.Time
-	breaks [][2]time.Time
-)
-for _, rw := range validRows {
-	r := rw.row
-	if len(r) < 3 { continue }
-	rowDate, t := fmt.Sprint(r[0]), fmt.Sprint(r[2])
-	if rowDate != date { continue }
-	ts, _ := time.ParseInLocation("15:04:05", fmt.Sprint(r[1]), time.Local)
-	ts = time.Date(0,1,1,ts.Hour(),ts.Minute(),ts.Second(),0,time.Local)
-	switch t {
-	case TypeStart:
-		startTime = ts
-	case TypeFinish:
-		finishTime = ts
-	case TypeLunch, TypeAfk:
-		breaks = append(breaks, [2]time.Time{ts, {}})
-	case TypeComeback:
-		if len(breaks) > 0 && breaks[len(breaks)-1][1].IsZero() {
-			breaks[len(breaks)-1][1] = ts
-		}
-	}
-}
-if startTime.IsZero() || finishTime.IsZero() {
-	return nil
-}
-var breakDur time.Duration
-for _, b := range breaks {
-	if !b[0].IsZero() && !b[1].IsZero() {
-		breakDur += b[1].Sub(b[0])
+	if finish == nil {
+		return nil // 対象の退勤行がなければ何もしない
 	}
-}
-workDur := finishTime.Sub(startTime) - breakDur
-if workDur < 0 { workDur = 0 }
-workStr := fmt.Sprintf("%d:%02d", int(workDur.Hours()), int(workDur.Minutes())%60)
-cell := fmt.Sprintf("E%d", validRows[lastFinishIdx].origIdx+1) // +1: 1-indexed
-_, err = srv.Spreadsheets.Values.Update(spreadsheetID, sheetName+"!"+cell, &sheets.ValueRange{Values: [][]interface{}{{workStr}}}).ValueInputOption("RAW").Do()
-if err != nil {
-	return fmt.Errorf("実働時間書き込み失敗: %w", err)
-}
 
-	return nil
-}
-
-// シート存在確認
-func sheetExists(srv *sheets.Service, spreadsheetID, sheetName string) (bool, error) {
-	ss, err := srv.Spreadsheets.Get(spreadsheetID).Do()
-	if err != nil {
-		return false, fmt.Errorf("スプレッドシート取得失敗: %w", err)
-	}
-	for _, s := range ss.Sheets {
-		if s.Properties.Title == sheetName {
-			return true, nil
+	if workDur, ok := workTime(valid, finish.Date); ok {
+		if err := s.updateCell(ctx, fmt.Sprintf("E%d", finish.Row), formatDuration(workDur)); err != nil {
+			return fmt.Errorf("実働時間書き込み失敗: %w", err)
 		}
 	}
-	return false, nil
-}
-
-// シート作成
-func createSheet(srv *sheets.Service, spreadsheetID, sheetName string) error {
-	rq := &sheets.BatchUpdateSpreadsheetRequest{
-		Requests: []*sheets.Request{
-			{
-				AddSheet: &sheets.AddSheetRequest{
-					Properties: &sheets.SheetProperties{
-						Title: sheetName,
-					},
-				},
-			},
-		},
-	}
-	_, err := srv.Spreadsheets.BatchUpdate(spreadsheetID, rq).Do()
-	if err != nil {
-		return fmt.Errorf("シート作成失敗: %w", err)
+	if err := c.updateSummary(ctx, s, userID, period, valid, finish.Date); err != nil {
+		slog.Error("Failed to update attendance summary", slog.String("user", userID), slog.Any("error", err))
 	}
 	return nil
 }
+
+func nowJST() time.Time {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	return time.Now().In(jst)
+}
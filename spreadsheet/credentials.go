@@ -0,0 +1,65 @@
+package spreadsheet
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	credentialsFileEnv   = "GOOGLE_CREDENTIALS_FILE"   // 認証情報JSONのパス
+	credentialsBase64Env = "GOOGLE_CREDENTIALS_BASE64" // base64エンコードした認証情報JSON
+	defaultCredentials   = "credentials.json"
+)
+
+// loadCredentials はGoogle認証情報を次の優先順で探す
+//  1. GOOGLE_CREDENTIALS_BASE64
+//  2. GOOGLE_CREDENTIALS_FILE
+//  3. カレントディレクトリの credentials.json
+//  4. Application Default Credentials（GOOGLE_APPLICATION_CREDENTIALS、gcloud、Workload Identity など）
+//
+// 戻り値の文字列はログ用の取得元
+func loadCredentials() (*google.Credentials, string, error) {
+	// トークンはリクエスト単位のctxに紐付けず、期限切れ時に自動で再取得させる
+	ctx := context.Background()
+
+	if encoded := os.Getenv(credentialsBase64Env); encoded != "" {
+		b, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, "", fmt.Errorf("%sのデコードに失敗: %w", credentialsBase64Env, err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, "", fmt.Errorf("%sのパースに失敗: %w", credentialsBase64Env, err)
+		}
+		return creds, credentialsBase64Env, nil
+	}
+
+	path := os.Getenv(credentialsFileEnv)
+	if path == "" {
+		if _, err := os.Stat(defaultCredentials); err == nil {
+			path = defaultCredentials
+		}
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("%sの読み込みに失敗: %w", path, err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, "", fmt.Errorf("%sのパースに失敗: %w", path, err)
+		}
+		return creds, path, nil
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, sheets.SpreadsheetsScope)
+	if err != nil {
+		return nil, "", fmt.Errorf("Google認証情報が見つかりません（%s / %s / %s / ADC）: %w", credentialsBase64Env, credentialsFileEnv, defaultCredentials, err)
+	}
+	return creds, "application default credentials", nil
+}
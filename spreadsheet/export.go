@@ -0,0 +1,160 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// monthSheet は指定月（"2006-01"）の記録が入っているユーザーのシートを返す
+// 月で分けないレイアウトでは全期間のシートを返すので、呼び出し側で日付を絞り込む
+func (c *Client) monthSheet(ctx context.Context, userID, month string) (sheet, bool, error) {
+	if c.layout == LayoutSingle {
+		month = ""
+	}
+	return c.userSheet(ctx, userID, month, false)
+}
+
+// Users は指定月の記録がありうるユーザーのIDを対応表から返す
+func (c *Client) Users(ctx context.Context, month string) ([]string, error) {
+	period := month
+	if c.layout == LayoutSingle {
+		period = ""
+	}
+	b, err := c.book(ctx, period, false)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	if err := b.loadUserMap(ctx); err != nil {
+		return nil, err
+	}
+
+	var users []string
+	b.mu.Lock()
+	for key := range b.userSheets {
+		if c.layout != LayoutMonthlyTab || key.period == period {
+			users = append(users, key.userID)
+		}
+	}
+	b.mu.Unlock()
+	sort.Strings(users)
+	return users, nil
+}
+
+// MonthRecords はユーザーの指定月の有効な記録を返す
+// 取消行と取消された行は除き、退勤行の実働時間はその日の最後の退勤行にだけ計算し直して入れる
+// 戻り値の名前はシート名（月別タブの期間の接尾辞は除く）
+func (c *Client) MonthRecords(ctx context.Context, userID, month string) (string, []Record, error) {
+	s, ok, err := c.monthSheet(ctx, userID, month)
+	if err != nil || !ok {
+		return "", nil, err
+	}
+	records, err := s.readRecords(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	valid := monthValidRecords(records, month)
+
+	name := s.title
+	if c.layout == LayoutMonthlyTab {
+		name = summaryName(s, month)
+	}
+	return name, valid, nil
+}
+
+// monthValidRecords は指定月の有効な記録だけを返す
+// 実働時間はその日の最後の有効な退勤行にだけ計算し直して入れる
+func monthValidRecords(records []Record, month string) []Record {
+	var valid []Record
+	for _, r := range validRecords(records) {
+		if strings.HasPrefix(r.Date, month+"-") {
+			valid = append(valid, r)
+		}
+	}
+
+	lastFinish := map[string]int{}
+	for i, r := range valid {
+		valid[i].WorkTime = ""
+		if r.Type == TypeFinish {
+			lastFinish[r.Date] = i
+		}
+	}
+	for date, i := range lastFinish {
+		if d, ok := workTime(valid, date); ok {
+			valid[i].WorkTime = formatDuration(d)
+		}
+	}
+	return valid
+}
+
+// MonthSummaries はユーザーの指定月の日ごとの集計を日付順に返す
+func (c *Client) MonthSummaries(ctx context.Context, userID, month string) (string, []DaySummary, error) {
+	name, valid, err := c.MonthRecords(ctx, userID, month)
+	if err != nil {
+		return "", nil, err
+	}
+	var summaries []DaySummary
+	seen := map[string]bool{}
+	for _, r := range valid {
+		if seen[r.Date] {
+			continue
+		}
+		seen[r.Date] = true
+		if summary, ok := summarizeDay(valid, r.Date); ok {
+			summaries = append(summaries, summary)
+		}
+	}
+	return name, summaries, nil
+}
+
+// Recalc は指定月の全ユーザーの実働時間セルを計算し直す
+// 日ごとの最後の有効な退勤行にだけ実働時間を入れ、それ以外の行の実働時間セルは空にする
+// 書き換えたセルの数を返す
+func (c *Client) Recalc(ctx context.Context, month string) (int, error) {
+	users, err := c.Users(ctx, month)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, uid := range users {
+		s, ok, err := c.monthSheet(ctx, uid, month)
+		if err != nil {
+			return updated, err
+		}
+		if !ok {
+			continue
+		}
+		records, err := s.readRecords(ctx)
+		if err != nil {
+			return updated, err
+		}
+		want := map[int]string{}
+		for _, r := range monthValidRecords(records, month) {
+			want[r.Row] = r.WorkTime
+		}
+
+		var data []*sheets.ValueRange
+		for _, r := range records {
+			if !strings.HasPrefix(r.Date, month+"-") || r.WorkTime == want[r.Row] {
+				continue
+			}
+			data = append(data, &sheets.ValueRange{
+				Range:  a1(s.title, fmt.Sprintf("E%d", r.Row)),
+				Values: [][]interface{}{{want[r.Row]}},
+			})
+		}
+		if len(data) == 0 {
+			continue
+		}
+		rq := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+		if _, err := s.book.srv.Spreadsheets.Values.BatchUpdate(s.book.id, rq).Context(ctx).Do(); err != nil {
+			return updated, fmt.Errorf("%sの実働時間書き込み失敗: %w", s.title, err)
+		}
+		updated += len(data)
+	}
+	return updated, nil
+}
@@ -0,0 +1,64 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonthValidRecords(t *testing.T) {
+	records := []Record{
+		// 前月末の勤務は含めない
+		{Row: 2, Date: "2026-09-30", Time: "09:00:00", Type: TypeStart},
+		{Row: 3, Date: "2026-09-30", Time: "18:00:00", Type: TypeFinish, WorkTime: "9:00"},
+		{Row: 4, Date: "2026-10-01", Time: "09:00:00", Type: TypeStart},
+		{Row: 5, Date: "2026-10-01", Time: "12:00:00", Type: "外出"},
+		{Row: 6, Date: "2026-10-01", Time: "13:00:00", Type: TypeComeback},
+		// 取り消された退勤にシートの実働時間が残っていても出さない
+		{Row: 7, Date: "2026-10-01", Time: "17:00:00", Type: TypeFinish, WorkTime: "7:00"},
+		{Row: 8, Date: "2026-10-01", Time: "17:01:00", Type: TypeCancel, Message: "行7(退勤 17:00:00)"},
+		{Row: 9, Date: "2026-10-01", Time: "18:30:00", Type: TypeFinish, WorkTime: "1:00"},
+		// 退勤が2回ある日は最後の退勤にだけ実働時間を入れる
+		{Row: 10, Date: "2026-10-02", Time: "09:00:00", Type: TypeStart},
+		{Row: 11, Date: "2026-10-02", Time: "12:00:00", Type: TypeFinish, WorkTime: "3:00"},
+		{Row: 12, Date: "2026-10-02", Time: "17:00:00", Type: TypeFinish},
+		// 出勤のない日は実働時間を消す
+		{Row: 13, Date: "2026-10-03", Time: "18:00:00", Type: TypeFinish, WorkTime: "8:00"},
+		// "2026-10" で始まっても別の月の日付は含めない
+		{Row: 14, Date: "2026-100-01", Time: "09:00:00", Type: TypeStart},
+		{Row: 15, Date: "2026-11-01", Time: "09:00:00", Type: TypeStart},
+	}
+
+	got := monthValidRecords(records, "2026-10")
+	type row struct {
+		Row      int
+		WorkTime string
+	}
+	var rows []row
+	for _, r := range got {
+		rows = append(rows, row{r.Row, r.WorkTime})
+	}
+	want := []row{
+		{4, ""},
+		{5, ""},
+		{6, ""},
+		{9, "8:30"},
+		{10, ""},
+		{11, ""},
+		{12, "8:00"},
+		{13, ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("monthValidRecords = %v, want %v", rows, want)
+	}
+	// 元の記録は書き換えない
+	if records[7].WorkTime != "1:00" {
+		t.Errorf("the sheet's record was changed: %+v", records[7])
+	}
+}
+
+func TestMonthValidRecordsEmpty(t *testing.T) {
+	records := []Record{{Row: 2, Date: "2026-09-30", Time: "09:00:00", Type: TypeStart}}
+	if got := monthValidRecords(records, "2026-10"); len(got) != 0 {
+		t.Errorf("monthValidRecords = %+v", got)
+	}
+}
@@ -0,0 +1,251 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// mergedSuffix は統合元のシートに付ける接尾辞
+const mergedSuffix = " (統合済み)"
+
+// MergeResult はシート統合の結果
+type MergeResult struct {
+	UserID string
+	Sheet  string   // 統合先のシート名
+	Merged []string // 統合したシート名
+	Rows   int      // 統合後の行数（ヘッダー除く）
+}
+
+// MigrateRenamedSheets は表示名の変更で分かれてしまったシートをユーザーごとに統合する
+// 対象は ATTENDANCE_SPREADSHEET_ID の月で分けていないシート
+// 現在の姓名・表示名・本名・ユーザーIDと同名で、他のユーザーに紐付いていないシートを同一人物のものとみなす
+// 旧表示名のシートは自動では判別できないので MergeSheets で明示的に統合する
+func (c *Client) MigrateRenamedSheets(ctx context.Context) ([]MergeResult, error) {
+	users, err := c.slackClient.GetUsersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Slackユーザー一覧取得失敗: %w", err)
+	}
+	if err := c.root.loadUserMap(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.root.refreshSheets(ctx); err != nil {
+		return nil, err
+	}
+
+	var results []MergeResult
+	for _, u := range users {
+		if u.IsBot || u.Deleted {
+			continue
+		}
+		var (
+			sources []string
+			ids     []int64
+		)
+		seen := map[string]bool{}
+		for _, name := range []string{
+			u.Profile.FirstName + u.Profile.LastName,
+			u.Profile.RealName,
+			u.Profile.DisplayName,
+			u.RealName,
+			u.ID,
+		} {
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			id, ok := c.root.cachedSheetByTitle(name)
+			if !ok {
+				continue
+			}
+			if owner := c.root.sheetOwner(id); owner != "" && owner != u.ID {
+				continue
+			}
+			sources = append(sources, name)
+			ids = append(ids, id)
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		if _, mapped := c.root.mappedTitle(userKey{userID: u.ID}); !mapped && len(sources) == 1 {
+			// 同名シートが1つだけなら対応表に登録するだけでよい
+			// 見つけたのは表示名や本名のシートかもしれないので、userSheet で引き直さずにそのシートを登録する
+			if err := c.root.mapUserSheet(ctx, userKey{userID: u.ID}, ids[0], sources[0]); err != nil {
+				return results, err
+			}
+			continue
+		}
+
+		result, err := c.MergeSheets(ctx, u.ID, sources...)
+		if err != nil {
+			return results, err
+		}
+		if len(result.Merged) > 0 {
+			results = append(results, *result)
+		}
+	}
+	return results, nil
+}
+
+// MergeSheets は指定したシートの記録をユーザーのシートに統合する
+// 記録は日時順に並べ直し、取消行が指す行番号も付け替える
+// 統合元のシートは削除せず、名前に「(統合済み)」を付けて非表示にする
+// 統合中はそのユーザーの記録の追加・取消を待たせる
+func (c *Client) MergeSheets(ctx context.Context, userID string, sources ...string) (*MergeResult, error) {
+	unlock, err := c.lockUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	s, _, err := c.userSheet(ctx, userID, "", true)
+	if err != nil {
+		return nil, err
+	}
+	target := s.title
+	result := &MergeResult{UserID: userID, Sheet: target}
+
+	titles := []string{target}
+	for _, src := range sources {
+		if src != target {
+			titles = append(titles, src)
+		}
+	}
+	if len(titles) == 1 {
+		return result, nil
+	}
+	bySheet := make([][]Record, len(titles))
+	for i, title := range titles {
+		records, err := (sheet{c.root, title}).readRecords(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", title, err)
+		}
+		bySheet[i] = records
+	}
+	merged := mergeRecords(bySheet)
+
+	values := make([][]interface{}, len(merged))
+	for i, r := range merged {
+		values[i] = r.values()
+	}
+	// 先に上書きしてから残りの行だけを消す。途中で失敗しても統合先の記録が消えたままにはならない
+	if len(values) > 0 {
+		vr := &sheets.ValueRange{Values: values}
+		if _, err := c.srv.Spreadsheets.Values.Update(c.root.id, a1(target, "A2"), vr).ValueInputOption("RAW").Context(ctx).Do(); err != nil {
+			return nil, fmt.Errorf("統合先シートの書き込み失敗: %w", err)
+		}
+	}
+	rest := a1(target, fmt.Sprintf("A%d:H", len(values)+2))
+	if _, err := c.srv.Spreadsheets.Values.Clear(c.root.id, rest, &sheets.ClearValuesRequest{}).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("統合先シートのクリア失敗: %w", err)
+	}
+
+	var requests []*sheets.Request
+	for _, title := range titles[1:] {
+		id, ok, err := c.root.sheetByTitle(ctx, title)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Properties: &sheets.SheetProperties{
+					SheetId: id,
+					Title:   title + mergedSuffix,
+					Hidden:  true,
+				},
+				Fields: "title,hidden",
+			},
+		})
+		result.Merged = append(result.Merged, title)
+	}
+	if len(requests) > 0 {
+		rq := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+		if _, err := c.srv.Spreadsheets.BatchUpdate(c.root.id, rq).Context(ctx).Do(); err != nil {
+			return nil, fmt.Errorf("統合元シートの非表示化失敗: %w", err)
+		}
+	}
+	if err := c.root.refreshSheets(ctx); err != nil {
+		return nil, err
+	}
+
+	result.Rows = len(merged)
+	slog.Info("Merged attendance sheets", slog.String("user", userID), slog.String("sheet", target), slog.Any("merged", result.Merged), slog.Int("rows", result.Rows))
+	return result, nil
+}
+
+// mergeRecords は複数のシートの記録を日時順に並べて1つのシートの行にする
+// 行番号は2行目から振り直し、取消行が指す行番号も同じシートの行の新しい番号に付け替える
+// 出勤と退勤が別シートに分かれていた日もあるので、日ごとの最後の退勤行の実働時間は計算し直す
+func mergeRecords(bySheet [][]Record) []Record {
+	type item struct {
+		sheet int
+		rec   Record
+	}
+	var items []item
+	for i, records := range bySheet {
+		for _, r := range records {
+			items = append(items, item{sheet: i, rec: r})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].rec, items[j].rec
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Time < b.Time
+	})
+
+	// 統合前の（シート, 行番号）→ 統合後の行番号
+	type origin struct {
+		sheet int
+		row   int
+	}
+	newRows := make(map[origin]int, len(items))
+	byOrigin := make(map[origin]Record, len(items))
+	for i, it := range items {
+		o := origin{it.sheet, it.rec.Row}
+		newRows[o] = i + 2 // ヘッダー分
+		byOrigin[o] = it.rec
+	}
+
+	merged := make([]Record, len(items))
+	for i, it := range items {
+		r := it.rec
+		if r.Type == TypeCancel {
+			o := origin{it.sheet, cancelTarget(r.Message)}
+			if row, ok := newRows[o]; ok {
+				orig := byOrigin[o]
+				// 取消理由など行番号以降の部分は残す
+				rest := ""
+				if i := strings.Index(r.Message, ")"); i >= 0 {
+					rest = r.Message[i+1:]
+				}
+				r.Message = fmt.Sprintf("行%d(%s %s)", row, orig.Type, orig.Time) + rest
+			}
+		}
+		r.Row = i + 2
+		merged[i] = r
+	}
+
+	valid := validRecords(merged)
+	lastFinish := map[string]int{}
+	for _, r := range valid {
+		if r.Type == TypeFinish {
+			lastFinish[r.Date] = r.Row
+		}
+	}
+	for date, row := range lastFinish {
+		if d, ok := workTime(valid, date); ok {
+			merged[row-2].WorkTime = formatDuration(d)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,135 @@
+package spreadsheet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeRecords(t *testing.T) {
+	// 統合先（新しい名前のシート）
+	current := []Record{
+		rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+		rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+		rec(4, "2026-10-16", "18:01:00", TypeCancel, "行3(退勤 18:00:00) 押し間違い"),
+		rec(5, "2026-10-16", "19:00:00", TypeFinish, ""),
+	}
+	// 表示名を変える前のシート。行番号は統合先と重なっている
+	old := []Record{
+		rec(2, "2026-10-15", "09:30:00", TypeStart, ""),
+		rec(3, "2026-10-15", "12:00:00", "外出", ""),
+		rec(4, "2026-10-15", "13:00:00", TypeComeback, ""),
+		rec(5, "2026-10-15", "17:30:00", TypeFinish, ""),
+		rec(6, "2026-10-15", "17:31:00", TypeCancel, "3"),
+	}
+	// 出勤だけ古いシートに残った日
+	split := []Record{
+		rec(2, "2026-10-17", "09:00:00", TypeStart, ""),
+	}
+	currentNext := rec(6, "2026-10-17", "17:00:00", TypeFinish, "")
+
+	merged := mergeRecords([][]Record{append(current, currentNext), old, split})
+
+	type row struct {
+		Row      int
+		Date     string
+		Time     string
+		Type     string
+		Message  string
+		WorkTime string
+	}
+	var got []row
+	for _, r := range merged {
+		got = append(got, row{r.Row, r.Date, r.Time, r.Type, r.Message, r.WorkTime})
+	}
+	want := []row{
+		{2, "2026-10-15", "09:30:00", TypeStart, "", ""},
+		{3, "2026-10-15", "12:00:00", "外出", "", ""},
+		{4, "2026-10-15", "13:00:00", TypeComeback, "", ""},
+		// 外出が取り消されたので休憩はない
+		{5, "2026-10-15", "17:30:00", TypeFinish, "", "8:00"},
+		// 古い形式の取消も、同じシートの行の新しい番号で書き直す
+		{6, "2026-10-15", "17:31:00", TypeCancel, "行3(外出 12:00:00)", ""},
+		{7, "2026-10-16", "09:00:00", TypeStart, "", ""},
+		{8, "2026-10-16", "18:00:00", TypeFinish, "", ""},
+		// 取消理由は残す
+		{9, "2026-10-16", "18:01:00", TypeCancel, "行8(退勤 18:00:00) 押し間違い", ""},
+		{10, "2026-10-16", "19:00:00", TypeFinish, "", "10:00"},
+		// 別のシートに分かれていた出勤と退勤で実働時間を計算する
+		{11, "2026-10-17", "09:00:00", TypeStart, "", ""},
+		{12, "2026-10-17", "17:00:00", TypeFinish, "", "8:00"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeRecords =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestMergeRecordsKeepsUnknownTargets(t *testing.T) {
+	// 取消対象の行がどのシートにもなければ、メッセージはそのまま
+	merged := mergeRecords([][]Record{
+		{rec(2, "2026-10-16", "09:00:00", TypeCancel, "行40(出勤 08:00:00)")},
+		nil,
+	})
+	if len(merged) != 1 || merged[0].Message != "行40(出勤 08:00:00)" || merged[0].Row != 2 {
+		t.Errorf("mergeRecords = %+v", merged)
+	}
+}
+
+// memClaims は store の代わりに使う確保先
+type memClaims struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (m *memClaims) FirstSeen(_ context.Context, id string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen[id] {
+		return false, nil
+	}
+	m.seen[id] = true
+	return true, nil
+}
+
+func (m *memClaims) ForgetSeen(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.seen, id)
+	return nil
+}
+
+func TestLockUser(t *testing.T) {
+	// serve と migrate のように、確保先を共有する別々のクライアント
+	claims := &memClaims{seen: map[string]bool{}}
+	serve := &Client{claims: claims, userLocks: map[string]*sync.Mutex{}}
+	migrate := &Client{claims: claims, userLocks: map[string]*sync.Mutex{}}
+
+	unlock, err := migrate.lockUser(context.Background(), "U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 統合中のユーザーへの書き込みは待たされる
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := serve.lockUser(ctx, "U1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lockUser(U1) while merging = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// ほかのユーザーは待たされない
+	other, err := serve.lockUser(context.Background(), "U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	unlock()
+	again, err := serve.lockUser(context.Background(), "U1")
+	if err != nil {
+		t.Fatalf("lockUser(U1) after merge: %v", err)
+	}
+	again()
+}
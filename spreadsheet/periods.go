@@ -0,0 +1,146 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const layoutEnv = "ATTENDANCE_LAYOUT" // 勤怠シートの分け方
+
+// Layout は勤怠シートの分け方
+type Layout string
+
+const (
+	// LayoutSingle はユーザーごとに1つのシートにすべての記録を追記する（デフォルト）
+	LayoutSingle Layout = "single"
+	// LayoutMonthlyTab はユーザーごと・月ごとにシートを分ける
+	LayoutMonthlyTab Layout = "monthly_tab"
+	// LayoutMonthlySpreadsheet は月ごとにスプレッドシートを分け、その中にユーザーごとのシートを作る
+	LayoutMonthlySpreadsheet Layout = "monthly_spreadsheet"
+)
+
+// periodMapSheet は月別スプレッドシートのIDを保存する非表示シート（ATTENDANCE_SPREADSHEET_ID側に作る）
+// 事前に作成したスプレッドシートをここに登録しておけば、自動作成の代わりにそれを使う
+const periodMapSheet = "_periods"
+
+var periodMapHeader = []interface{}{"期間", "スプレッドシートID"}
+
+func layoutFromEnv() (Layout, error) {
+	switch l := Layout(os.Getenv(layoutEnv)); l {
+	case "":
+		return LayoutSingle, nil
+	case LayoutSingle, LayoutMonthlyTab, LayoutMonthlySpreadsheet:
+		return l, nil
+	default:
+		return "", fmt.Errorf("環境変数 %s の値が不正です: %s（%s / %s / %s）", layoutEnv, l, LayoutSingle, LayoutMonthlyTab, LayoutMonthlySpreadsheet)
+	}
+}
+
+// periodOf は日時が属する期間を返す。月で分けないレイアウトでは空文字
+func (c *Client) periodOf(t time.Time) string {
+	if c.layout == LayoutSingle {
+		return ""
+	}
+	return t.Format("2006-01")
+}
+
+// recentPeriods は取消対象を探す期間を新しい順に返す
+// 月初直後でも前月末の記録を取り消せるように前月も含める
+func (c *Client) recentPeriods(t time.Time) []string {
+	if c.layout == LayoutSingle {
+		return []string{""}
+	}
+	prev := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, -1, 0)
+	return []string{c.periodOf(t), c.periodOf(prev)}
+}
+
+// book は期間の記録を置くスプレッドシートを返す
+// 月別スプレッドシートで未作成の場合、createがtrueなら作成して登録し、falseならnilを返す
+func (c *Client) book(ctx context.Context, period string, create bool) (*book, error) {
+	if c.layout != LayoutMonthlySpreadsheet || period == "" {
+		return c.root, nil
+	}
+
+	c.mu.Lock()
+	b, ok := c.books[period]
+	c.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+
+	// 同じ月のスプレッドシートが並行して作られないように直列化する
+	c.periodMu.Lock()
+	defer c.periodMu.Unlock()
+
+	periods, err := c.loadPeriods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := periods[period]
+	if !ok {
+		if !create {
+			return nil, nil
+		}
+		if id, err = c.createPeriodSpreadsheet(ctx, period); err != nil {
+			return nil, err
+		}
+	}
+
+	b = newBook(c.srv, id)
+	c.mu.Lock()
+	c.periods[period] = id
+	c.books[period] = b
+	c.mu.Unlock()
+	return b, nil
+}
+
+// loadPeriods は期間 → スプレッドシートIDの対応を返す。未取得なら読み込む
+func (c *Client) loadPeriods(ctx context.Context) (map[string]string, error) {
+	c.mu.Lock()
+	periods := c.periods
+	c.mu.Unlock()
+	if periods != nil {
+		return periods, nil
+	}
+
+	if err := c.root.ensureSheet(ctx, periodMapSheet, true, periodMapHeader); err != nil {
+		return nil, err
+	}
+	values, err := c.root.readValues(ctx, periodMapSheet, "A:B")
+	if err != nil {
+		return nil, err
+	}
+	periods = map[string]string{}
+	for i, row := range values {
+		if i == 0 || len(row) < 2 {
+			continue
+		}
+		periods[fmt.Sprint(row[0])] = fmt.Sprint(row[1])
+	}
+
+	c.mu.Lock()
+	c.periods = periods
+	c.mu.Unlock()
+	return periods, nil
+}
+
+// createPeriodSpreadsheet は月別のスプレッドシートを作成して対応表に登録する
+func (c *Client) createPeriodSpreadsheet(ctx context.Context, period string) (string, error) {
+	ss, err := c.srv.Spreadsheets.Create(&sheets.Spreadsheet{
+		Properties: &sheets.SpreadsheetProperties{
+			Title:    "勤怠 " + period,
+			TimeZone: "Asia/Tokyo",
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("%sのスプレッドシート作成失敗: %w", period, err)
+	}
+	if _, err := c.root.appendRow(ctx, periodMapSheet, []interface{}{period, ss.SpreadsheetId}); err != nil {
+		return "", fmt.Errorf("期間対応表の更新失敗: %w", err)
+	}
+	return ss.SpreadsheetId, nil
+}
@@ -0,0 +1,100 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeriods(t *testing.T) {
+	jst, _ := time.LoadLocation("Asia/Tokyo")
+	tests := []struct {
+		layout Layout
+		at     time.Time
+		period string
+		recent []string
+	}{
+		{LayoutSingle, time.Date(2026, 11, 1, 0, 5, 0, 0, jst), "", []string{""}},
+		{LayoutMonthlyTab, time.Date(2026, 10, 31, 23, 59, 59, 0, jst), "2026-10", []string{"2026-10", "2026-09"}},
+		{LayoutMonthlyTab, time.Date(2026, 11, 1, 0, 0, 0, 0, jst), "2026-11", []string{"2026-11", "2026-10"}},
+		{LayoutMonthlySpreadsheet, time.Date(2027, 1, 1, 0, 5, 0, 0, jst), "2027-01", []string{"2027-01", "2026-12"}},
+		// 31日から前月を引いても月をまたぎすぎない
+		{LayoutMonthlyTab, time.Date(2026, 3, 31, 9, 0, 0, 0, jst), "2026-03", []string{"2026-03", "2026-02"}},
+	}
+	for _, tt := range tests {
+		c := &Client{layout: tt.layout}
+		if got := c.periodOf(tt.at); got != tt.period {
+			t.Errorf("%s periodOf(%v) = %q, want %q", tt.layout, tt.at, got, tt.period)
+		}
+		if got := c.recentPeriods(tt.at); !reflect.DeepEqual(got, tt.recent) {
+			t.Errorf("%s recentPeriods(%v) = %q, want %q", tt.layout, tt.at, got, tt.recent)
+		}
+	}
+}
+
+func TestWorkTimeAcrossDays(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []Record // 同じシートの記録
+		date    string
+		want    string // 空なら計算しない
+	}{
+		{
+			name: "same day",
+			records: []Record{
+				rec(2, "2026-10-30", "22:00:00", TypeStart, ""),
+				rec(3, "2026-10-30", "23:30:00", TypeFinish, ""),
+			},
+			date: "2026-10-30",
+			want: "1:30",
+		},
+		{
+			name: "finish after midnight, start day",
+			records: []Record{
+				rec(2, "2026-10-30", "22:00:00", TypeStart, ""),
+				rec(3, "2026-10-31", "02:00:00", TypeFinish, ""),
+			},
+			date: "2026-10-30",
+		},
+		{
+			name: "finish after midnight, finish day",
+			records: []Record{
+				rec(2, "2026-10-30", "22:00:00", TypeStart, ""),
+				rec(3, "2026-10-31", "02:00:00", TypeFinish, ""),
+			},
+			date: "2026-10-31",
+		},
+		{
+			// 月別レイアウトでは 11/1 の退勤は翌月のシートに入り、出勤のない日になる
+			name: "finish in the next month's sheet",
+			records: []Record{
+				rec(2, "2026-11-01", "01:00:00", TypeFinish, ""),
+			},
+			date: "2026-11-01",
+		},
+		{
+			name: "the next day's session is counted on its own",
+			records: []Record{
+				rec(2, "2026-10-30", "22:00:00", TypeStart, ""),
+				rec(3, "2026-10-31", "02:00:00", TypeFinish, ""),
+				rec(4, "2026-10-31", "09:00:00", TypeStart, ""),
+				rec(5, "2026-10-31", "18:00:00", TypeFinish, ""),
+			},
+			date: "2026-10-31",
+			// 02:00 の退勤は 09:00 の出勤より前なので、最後の退勤 18:00 との差になる
+			want: "9:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := workTime(validRecords(tt.records), tt.date)
+			got := ""
+			if ok {
+				got = formatDuration(d)
+			}
+			if got != tt.want {
+				t.Errorf("workTime(%s) = %q, want %q", tt.date, got, tt.want)
+			}
+		})
+	}
+}
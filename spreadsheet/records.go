@@ -0,0 +1,231 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyama86/slack-afk/go/catalog"
+)
+
+// Record はシート上の勤怠記録1行
+type Record struct {
+	Row      int // シート上の行番号（1-indexed）
+	Date     string
+	Time     string
+	Type     string
+	Message  string
+	WorkTime string
+	ID       string // 記録ID（同じ操作の再送で二重に記録しないためのもの。古い行は空）
+	Location string // 勤務地（出勤行だけ。指定がなければ空）
+	Report   string // 日報（退勤行だけ。/finish --report で入力したもの）
+}
+
+// parseRecords はシートの値をRecordに変換する（先頭のヘッダー行は除く）
+func parseRecords(values [][]interface{}) []Record {
+	var records []Record
+	for i, row := range values {
+		if i == 0 || len(row) < 3 {
+			continue
+		}
+		r := Record{
+			Row:  i + 1,
+			Date: fmt.Sprint(row[0]),
+			Time: fmt.Sprint(row[1]),
+			Type: fmt.Sprint(row[2]),
+		}
+		if len(row) > 3 {
+			r.Message = fmt.Sprint(row[3])
+		}
+		if len(row) > 4 {
+			r.WorkTime = fmt.Sprint(row[4])
+		}
+		if len(row) > 5 {
+			r.ID = fmt.Sprint(row[5])
+		}
+		if len(row) > 6 {
+			r.Location = fmt.Sprint(row[6])
+		}
+		if len(row) > 7 {
+			r.Report = fmt.Sprint(row[7])
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// validRecords は取消行・取消対象行を除いた有効な記録だけを返す
+func validRecords(records []Record) []Record {
+	cancelled := map[int]bool{}
+	for _, r := range records {
+		if r.Type == TypeCancel {
+			// メッセージ欄に取消対象行番号が入っている
+			if target := cancelTarget(r.Message); target > 0 {
+				cancelled[target] = true
+			}
+		}
+	}
+
+	var valid []Record
+	for _, r := range records {
+		if r.Type == TypeCancel || cancelled[r.Row] {
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return valid
+}
+
+// lastValid は取消の対象になる記録（最後に追加された有効な記録）と、それを取り消した後に残る有効な記録を返す
+// 有効な記録がなければ false。取り消された記録は飛ばすので、続けて取り消すと一つずつさかのぼる
+func lastValid(records []Record) (Record, []Record, bool) {
+	valid := validRecords(records)
+	if len(valid) == 0 {
+		return Record{}, nil, false
+	}
+	return valid[len(valid)-1], valid[:len(valid)-1], true
+}
+
+// cancelledBy は記録IDが id の取消行が取り消した行を返す（id が空か、該当する取消行がなければ false）
+func cancelledBy(records []Record, id string) (Record, bool) {
+	if id == "" {
+		return Record{}, false
+	}
+	target := 0
+	for _, r := range records {
+		if r.Type == TypeCancel && r.ID == id {
+			target = cancelTarget(r.Message)
+			break
+		}
+	}
+	for _, r := range records {
+		if target > 0 && r.Row == target {
+			return r, true
+		}
+	}
+	return Record{}, false
+}
+
+// cancelTarget は取消行のメッセージ（"行12(退勤 18:00:00) 理由" もしくは "12"）から取消対象の行番号を取り出す
+func cancelTarget(message string) int {
+	s := strings.TrimPrefix(message, "行")
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		s = s[:end]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// DaySummary は1日分の勤怠の集計
+type DaySummary struct {
+	Date     string
+	Start    string // 出勤時刻（なければ空）
+	Finish   string // 退勤時刻（なければ空）
+	Location string // 出勤時に指定した勤務地（なければ空）
+	Break    time.Duration
+	Work     time.Duration // 出勤・退勤の両方があるときだけ計算する
+}
+
+// HasWork は実働時間を計算できたかを返す
+func (d DaySummary) HasWork() bool {
+	return d.Start != "" && d.Finish != ""
+}
+
+// summarizeDay は指定日の有効な記録から出勤・退勤・休憩・実働時間を集計する
+// その日の有効な記録がなければ false を返す
+// 記録は日付ごとに集計するので、日付をまたいだ勤務はどちらの日も出勤か退勤が欠けて実働時間を計算しない
+func summarizeDay(valid []Record, date string) (DaySummary, bool) {
+	var (
+		startTime, finishTime time.Time
+		breaks                [][2]time.Time
+		found                 bool
+	)
+	summary := DaySummary{Date: date}
+	// 管理者が後から追加した行は時刻順に並んでいないので、時刻で並べてから集計する
+	var day []Record
+	for _, r := range valid {
+		if r.Date == date {
+			day = append(day, r)
+		}
+	}
+	sort.SliceStable(day, func(i, j int) bool { return day[i].Time < day[j].Time })
+	for _, r := range day {
+		found = true
+		ts, err := time.Parse("15:04:05", r.Time)
+		if err != nil {
+			continue
+		}
+		switch r.Type {
+		case TypeStart:
+			startTime = ts
+			summary.Start = r.Time
+			if r.Location != "" {
+				summary.Location = r.Location
+			}
+		case TypeFinish:
+			finishTime = ts
+			summary.Finish = r.Time
+		case TypeComeback:
+			endBreak(breaks, ts)
+		default:
+			// 離席・外出などの状態はカタログで休憩かどうかが決まる
+			// 休憩でない状態（会議など）に切り替えたときは、そこで休憩が終わったものとする
+			if e, ok := catalog.Current().ByType(r.Type); ok {
+				if e.Break {
+					breaks = append(breaks, [2]time.Time{ts, {}})
+				} else {
+					endBreak(breaks, ts)
+				}
+			}
+		}
+	}
+	if !found {
+		return summary, false
+	}
+
+	for _, b := range breaks {
+		if !b[0].IsZero() && !b[1].IsZero() {
+			summary.Break += b[1].Sub(b[0])
+		}
+	}
+	if summary.HasWork() {
+		summary.Work = finishTime.Sub(startTime) - summary.Break
+		if summary.Work < 0 {
+			summary.Work = 0
+		}
+	}
+	return summary, true
+}
+
+// endBreak は終わっていない直近の休憩を ts で終える
+func endBreak(breaks [][2]time.Time, ts time.Time) {
+	if len(breaks) > 0 && breaks[len(breaks)-1][1].IsZero() {
+		breaks[len(breaks)-1][1] = ts
+	}
+}
+
+// workTime は指定日の有効な記録から実働時間（出勤～退勤から休憩を引いたもの）を計算する
+// 出勤・退勤のどちらかが欠けていれば false を返す
+func workTime(valid []Record, date string) (time.Duration, bool) {
+	summary, ok := summarizeDay(valid, date)
+	if !ok || !summary.HasWork() {
+		return 0, false
+	}
+	return summary.Work, true
+}
+
+// formatDuration は実働時間を "h:mm" 形式にする
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// values はシートに書き込む1行分の値を返す
+func (r Record) values() []interface{} {
+	return []interface{}{r.Date, r.Time, r.Type, r.Message, r.WorkTime, r.ID, r.Location, r.Report}
+}
@@ -0,0 +1,305 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rec はテスト用の記録（行番号・日付・時刻・種別・メッセージ）
+func rec(row int, date, tm, typ, msg string) Record {
+	return Record{Row: row, Date: date, Time: tm, Type: typ, Message: msg}
+}
+
+// rows は記録の行番号を並べたもの
+func rows(records []Record) []int {
+	var rs []int
+	for _, r := range records {
+		rs = append(rs, r.Row)
+	}
+	return rs
+}
+
+func TestCancelTarget(t *testing.T) {
+	tests := []struct {
+		message string
+		want    int
+	}{
+		{"行12(退勤 18:00:00)", 12},
+		{"行12(退勤 18:00:00) 押し間違い（管理者 yamada による取消）", 12},
+		{"12", 12},
+		{"行3", 3},
+		{"押し間違い", 0},
+		{"行(退勤 18:00:00)", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := cancelTarget(tt.message); got != tt.want {
+			t.Errorf("cancelTarget(%q) = %d, want %d", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestValidRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []Record
+		want    []int
+	}{
+		{name: "no records"},
+		{
+			name: "no cancels",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+			},
+			want: []int{2, 3},
+		},
+		{
+			name: "cancel removes itself and its target",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+				rec(4, "2026-10-16", "18:01:00", TypeCancel, "行3(退勤 18:00:00)"),
+				rec(5, "2026-10-16", "19:00:00", TypeFinish, ""),
+			},
+			want: []int{2, 5},
+		},
+		{
+			name: "consecutive cancels go back one record each",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "12:00:00", "外出", ""),
+				rec(4, "2026-10-16", "13:00:00", TypeComeback, ""),
+				rec(5, "2026-10-16", "13:01:00", TypeCancel, "行4(復帰 13:00:00)"),
+				rec(6, "2026-10-16", "13:02:00", TypeCancel, "行3(外出 12:00:00)"),
+			},
+			want: []int{2},
+		},
+		{
+			name: "cancelling a cancel row does not bring its target back",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "09:01:00", TypeCancel, "行2(出勤 09:00:00)"),
+				rec(4, "2026-10-16", "09:02:00", TypeCancel, "行3(取消 09:01:00)"),
+			},
+		},
+		{
+			name: "old cancel rows hold only the row number",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+				rec(4, "2026-10-16", "18:01:00", TypeCancel, "3"),
+			},
+			want: []int{2},
+		},
+		{
+			name: "a cancel without a row number cancels nothing",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "09:01:00", TypeCancel, "押し間違い"),
+			},
+			want: []int{2},
+		},
+		{
+			name: "a cancel before its target still applies",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeCancel, "行3(出勤 09:05:00)"),
+				rec(3, "2026-10-16", "09:05:00", TypeStart, ""),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rows(validRecords(tt.records)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validRecords = rows %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastValid(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []Record
+		target  int // 0: 取り消せる記録なし
+		rest    []int
+	}{
+		{name: "no records"},
+		{
+			name: "only cancels",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "09:01:00", TypeCancel, "行2(出勤 09:00:00)"),
+			},
+		},
+		{
+			name: "the last record",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+			},
+			target: 3,
+			rest:   []int{2},
+		},
+		{
+			name: "skips cancelled records",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "12:00:00", "離席", ""),
+				rec(4, "2026-10-16", "18:00:00", TypeFinish, ""),
+				rec(5, "2026-10-16", "18:01:00", TypeCancel, "行4(退勤 18:00:00)"),
+			},
+			target: 3,
+			rest:   []int{2},
+		},
+		{
+			// 管理者が後から追加した記録は時刻順でなくても、最後に追加されたものが対象
+			name: "the last appended, not the latest time",
+			records: []Record{
+				rec(2, "2026-10-16", "09:00:00", TypeStart, ""),
+				rec(3, "2026-10-16", "18:00:00", TypeFinish, ""),
+				rec(4, "2026-10-15", "18:30:00", TypeFinish, "打刻漏れ"),
+			},
+			target: 4,
+			rest:   []int{2, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, rest, ok := lastValid(tt.records)
+			if ok != (tt.target > 0) || target.Row != tt.target {
+				t.Fatalf("lastValid = row %d, %v, want row %d", target.Row, ok, tt.target)
+			}
+			if got := rows(rest); !reflect.DeepEqual(got, tt.rest) {
+				t.Errorf("rest = rows %v, want %v", got, tt.rest)
+			}
+		})
+	}
+}
+
+func TestSummarizeDay(t *testing.T) {
+	const date = "2026-10-16"
+	tests := []struct {
+		name    string
+		records []Record
+		want    DaySummary
+		ok      bool
+	}{
+		{name: "no records on the day", records: []Record{rec(2, "2026-10-15", "09:00:00", TypeStart, "")}},
+		{
+			name: "start only",
+			records: []Record{
+				{Row: 2, Date: date, Time: "09:00:00", Type: TypeStart, Location: "remote"},
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Location: "remote"},
+			ok:   true,
+		},
+		{
+			name: "lunch ended by comeback",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "12:00:00", "外出", ""),
+				rec(4, date, "13:00:00", TypeComeback, ""),
+				rec(5, date, "18:00:00", TypeFinish, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "18:00:00", Break: time.Hour, Work: 8 * time.Hour},
+			ok:   true,
+		},
+		{
+			// 会議は休憩ではないので、離席から会議に切り替えたところで休憩が終わる
+			name: "break ended by a status that is not a break",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "10:00:00", "離席", ""),
+				rec(4, date, "10:15:00", "会議", ""),
+				rec(5, date, "11:00:00", TypeComeback, ""),
+				rec(6, date, "18:00:00", TypeFinish, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "18:00:00", Break: 15 * time.Minute, Work: 8*time.Hour + 45*time.Minute},
+			ok:   true,
+		},
+		{
+			name: "several breaks",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "12:00:00", "外出", ""),
+				rec(4, date, "12:45:00", TypeComeback, ""),
+				rec(5, date, "15:00:00", "中抜け", ""),
+				rec(6, date, "16:30:00", TypeComeback, ""),
+				rec(7, date, "19:00:00", TypeFinish, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "19:00:00", Break: 2*time.Hour + 15*time.Minute, Work: 7*time.Hour + 45*time.Minute},
+			ok:   true,
+		},
+		{
+			// 終わっていない休憩は数えない
+			name: "break without an end",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "17:00:00", "離席", ""),
+				rec(4, date, "18:00:00", TypeFinish, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "18:00:00", Work: 9 * time.Hour},
+			ok:   true,
+		},
+		{
+			// 管理者が後から追加した行は時刻順に並べてから集計する
+			name: "rows added out of order",
+			records: []Record{
+				rec(2, date, "13:00:00", TypeComeback, ""),
+				rec(3, date, "18:00:00", TypeFinish, ""),
+				rec(4, date, "09:00:00", TypeStart, "打刻漏れ"),
+				rec(5, date, "12:00:00", "外出", "打刻漏れ"),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "18:00:00", Break: time.Hour, Work: 8 * time.Hour},
+			ok:   true,
+		},
+		{
+			name: "unknown types and bad times are ignored",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "10:00:00", "昼寝", ""),
+				rec(4, date, "11:00", "外出", ""),
+				rec(5, date, "17:00:00", TypeFinish, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "17:00:00", Work: 8 * time.Hour},
+			ok:   true,
+		},
+		{
+			name: "breaks longer than the day",
+			records: []Record{
+				rec(2, date, "09:00:00", TypeStart, ""),
+				rec(3, date, "09:30:00", TypeFinish, ""),
+				rec(4, date, "10:00:00", "外出", ""),
+				rec(5, date, "12:00:00", TypeComeback, ""),
+			},
+			want: DaySummary{Date: date, Start: "09:00:00", Finish: "09:30:00", Break: 2 * time.Hour},
+			ok:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := summarizeDay(validRecords(tt.records), date)
+			if ok != tt.ok {
+				t.Fatalf("summarizeDay ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("summarizeDay =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                             "0:00",
+		45 * time.Minute:              "0:45",
+		8*time.Hour + 5*time.Minute:   "8:05",
+		25*time.Hour + 59*time.Second: "25:00",
+	} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
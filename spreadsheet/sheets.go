@@ -0,0 +1,237 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// book は1つのスプレッドシートと、そのシート一覧・ユーザー対応表のキャッシュ
+type book struct {
+	srv *sheets.Service
+	id  string
+
+	mu          sync.Mutex
+	sheetTitles map[int64]string  // シートID → シート名（nilなら未取得）
+	userSheets  map[userKey]int64 // ユーザー → シートID（nilなら未取得）
+
+	resolveMu sync.Mutex // ユーザーのシート作成を直列化する
+	summaryMu sync.Mutex // 集計シートの更新を直列化する
+}
+
+func newBook(srv *sheets.Service, spreadsheetID string) *book {
+	return &book{srv: srv, id: spreadsheetID}
+}
+
+// sheet はスプレッドシート内の1つのシート
+type sheet struct {
+	book  *book
+	title string
+}
+
+// a1 はシート名をクォートしてA1表記の範囲を作る
+func a1(title, rng string) string {
+	return "'" + strings.ReplaceAll(title, "'", "''") + "'!" + rng
+}
+
+// refreshSheets はシート一覧（シートID → シート名）を取得し直してキャッシュする
+func (b *book) refreshSheets(ctx context.Context) error {
+	ss, err := b.srv.Spreadsheets.Get(b.id).Fields("sheets.properties(sheetId,title)").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("スプレッドシート取得失敗: %w", err)
+	}
+	titles := make(map[int64]string, len(ss.Sheets))
+	for _, s := range ss.Sheets {
+		titles[s.Properties.SheetId] = s.Properties.Title
+	}
+
+	b.mu.Lock()
+	b.sheetTitles = titles
+	b.mu.Unlock()
+	return nil
+}
+
+// invalidate はシート一覧のキャッシュを破棄する
+// 手動でシートが削除・改名された場合に備えて、書き込みに失敗したら呼ぶ
+func (b *book) invalidate() {
+	b.mu.Lock()
+	b.sheetTitles = nil
+	b.mu.Unlock()
+}
+
+// sheetTitle はシートIDから現在のシート名を返す
+// キャッシュになければ一覧を取得し直す
+func (b *book) sheetTitle(ctx context.Context, sheetID int64) (string, bool, error) {
+	b.mu.Lock()
+	title, ok := b.sheetTitles[sheetID]
+	b.mu.Unlock()
+	if ok {
+		return title, true, nil
+	}
+
+	if err := b.refreshSheets(ctx); err != nil {
+		return "", false, err
+	}
+	b.mu.Lock()
+	title, ok = b.sheetTitles[sheetID]
+	b.mu.Unlock()
+	return title, ok, nil
+}
+
+// sheetByTitle はシート名からシートIDを返す
+// キャッシュになければ一覧を取得し直す
+func (b *book) sheetByTitle(ctx context.Context, title string) (int64, bool, error) {
+	if id, ok := b.cachedSheetByTitle(title); ok {
+		return id, true, nil
+	}
+	if err := b.refreshSheets(ctx); err != nil {
+		return 0, false, err
+	}
+	id, ok := b.cachedSheetByTitle(title)
+	return id, ok, nil
+}
+
+func (b *book) cachedSheetByTitle(title string) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for id, t := range b.sheetTitles {
+		if t == title {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// シート作成
+// 作成したシートのIDを返す
+func (b *book) createSheet(ctx context.Context, title string, hidden bool) (int64, error) {
+	rq := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{
+				AddSheet: &sheets.AddSheetRequest{
+					Properties: &sheets.SheetProperties{
+						Title:  title,
+						Hidden: hidden,
+					},
+				},
+			},
+		},
+	}
+	resp, err := b.srv.Spreadsheets.BatchUpdate(b.id, rq).Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("シート作成失敗: %w", err)
+	}
+	if len(resp.Replies) == 0 || resp.Replies[0].AddSheet == nil {
+		return 0, fmt.Errorf("シート作成失敗: レスポンスにシート情報がありません")
+	}
+	id := resp.Replies[0].AddSheet.Properties.SheetId
+
+	b.mu.Lock()
+	if b.sheetTitles != nil {
+		b.sheetTitles[id] = title
+	}
+	b.mu.Unlock()
+	return id, nil
+}
+
+// createSheetWithHeader はシートを作成してヘッダー行を書き込む
+func (b *book) createSheetWithHeader(ctx context.Context, title string, hidden bool, header []interface{}) (int64, error) {
+	id, err := b.createSheet(ctx, title, hidden)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := b.appendRow(ctx, title, header); err != nil {
+		return 0, fmt.Errorf("ヘッダー追加失敗: %w", err)
+	}
+	return id, nil
+}
+
+// ensureSheet は指定した名前のシートがなければヘッダー付きで作成する
+func (b *book) ensureSheet(ctx context.Context, title string, hidden bool, header []interface{}) error {
+	_, exists, err := b.sheetByTitle(ctx, title)
+	if err != nil || exists {
+		return err
+	}
+	_, err = b.createSheetWithHeader(ctx, title, hidden, header)
+	return err
+}
+
+func (b *book) readValues(ctx context.Context, title, rng string) ([][]interface{}, error) {
+	resp, err := b.srv.Spreadsheets.Values.Get(b.id, a1(title, rng)).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("シートデータ取得失敗: %w", err)
+	}
+	return resp.Values, nil
+}
+
+// appendRow は行を追加し、追加された行番号（1-indexed）を返す
+func (b *book) appendRow(ctx context.Context, title string, row []interface{}) (int, error) {
+	vr := &sheets.ValueRange{Values: [][]interface{}{row}}
+	resp, err := b.srv.Spreadsheets.Values.Append(b.id, a1(title, "A1"), vr).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	if err != nil {
+		return 0, err
+	}
+	if resp == nil || resp.Updates == nil {
+		return 0, nil
+	}
+	return rowFromRange(resp.Updates.UpdatedRange), nil
+}
+
+func (b *book) updateCell(ctx context.Context, title, cell, value string) error {
+	vr := &sheets.ValueRange{Values: [][]interface{}{{value}}}
+	_, err := b.srv.Spreadsheets.Values.Update(b.id, a1(title, cell), vr).ValueInputOption("RAW").Context(ctx).Do()
+	return err
+}
+
+// readRecords はシートの全レコードを取得する（ヘッダー行は除く）
+func (s sheet) readRecords(ctx context.Context) ([]Record, error) {
+	values, err := s.book.readValues(ctx, s.title, "A:H")
+	if err != nil {
+		return nil, err
+	}
+	return parseRecords(values), nil
+}
+
+// findRecordID は記録IDが id の行番号を返す（なければ0。id が空なら読まずに0）
+func (s sheet) findRecordID(ctx context.Context, id string) (int, error) {
+	if id == "" {
+		return 0, nil
+	}
+	values, err := s.book.readValues(ctx, s.title, "F:F")
+	if err != nil {
+		return 0, err
+	}
+	for i, row := range values {
+		if len(row) > 0 && fmt.Sprint(row[0]) == id {
+			return i + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s sheet) appendRow(ctx context.Context, row []interface{}) (int, error) {
+	return s.book.appendRow(ctx, s.title, row)
+}
+
+func (s sheet) updateCell(ctx context.Context, cell, value string) error {
+	return s.book.updateCell(ctx, s.title, cell, value)
+}
+
+// rowFromRange は "シート名!A10:E10" のような範囲から行番号を取り出す
+func rowFromRange(updatedRange string) int {
+	i := strings.LastIndex(updatedRange, "!")
+	if i < 0 {
+		return 0
+	}
+	rowParts := strings.Split(updatedRange[i+1:], ":")
+	rowStr := strings.TrimLeft(rowParts[0], "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	n, err := strconv.Atoi(rowStr)
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// summarySheet はユーザーごと・日ごとの勤怠をまとめたシート
+// 月別スプレッドシートのレイアウトでは各月のスプレッドシートに作る
+const summarySheet = "集計"
+
+var summaryHeader = []interface{}{"日付", "ユーザーID", "名前", "出勤", "退勤", "休憩（h:mm）", "実働時間（h:mm）", "勤務地"}
+
+func summaryRow(userID, name string, d DaySummary) []interface{} {
+	work := ""
+	if d.HasWork() {
+		work = formatDuration(d.Work)
+	}
+	return []interface{}{d.Date, userID, name, d.Start, d.Finish, formatDuration(d.Break), work, d.Location}
+}
+
+// summaryName は集計シートに載せる名前。月別タブの期間の接尾辞は取り除く
+func summaryName(s sheet, period string) string {
+	if period == "" {
+		return s.title
+	}
+	return strings.TrimSuffix(s.title, " "+period)
+}
+
+// updateSummary はユーザーの指定日の集計行を更新する
+// その日の有効な記録がなくなっていれば行を削除する
+func (c *Client) updateSummary(ctx context.Context, s sheet, userID, period string, valid []Record, date string) error {
+	b := s.book
+	b.summaryMu.Lock()
+	defer b.summaryMu.Unlock()
+
+	if err := b.ensureSheet(ctx, summarySheet, false, summaryHeader); err != nil {
+		return err
+	}
+	values, err := b.readValues(ctx, summarySheet, "A:B")
+	if err != nil {
+		return err
+	}
+	rowNum := 0
+	for i, row := range values {
+		if i > 0 && len(row) >= 2 && fmt.Sprint(row[0]) == date && fmt.Sprint(row[1]) == userID {
+			rowNum = i + 1
+			break
+		}
+	}
+
+	summary, ok := summarizeDay(valid, date)
+	switch {
+	case ok && rowNum > 0:
+		vr := &sheets.ValueRange{Values: [][]interface{}{summaryRow(userID, summaryName(s, period), summary)}}
+		_, err = b.srv.Spreadsheets.Values.Update(b.id, a1(summarySheet, fmt.Sprintf("A%d", rowNum)), vr).ValueInputOption("RAW").Context(ctx).Do()
+	case ok:
+		_, err = b.appendRow(ctx, summarySheet, summaryRow(userID, summaryName(s, period), summary))
+	case rowNum > 0:
+		err = b.deleteRow(ctx, summarySheet, rowNum)
+	}
+	if err != nil {
+		return fmt.Errorf("集計シート更新失敗: %w", err)
+	}
+	return nil
+}
+
+// deleteRow はシートの行（1-indexed）を削除する
+func (b *book) deleteRow(ctx context.Context, title string, rowNum int) error {
+	id, ok, err := b.sheetByTitle(ctx, title)
+	if err != nil || !ok {
+		return err
+	}
+	rq := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{
+				DeleteDimension: &sheets.DeleteDimensionRequest{
+					Range: &sheets.DimensionRange{
+						SheetId:    id,
+						Dimension:  "ROWS",
+						StartIndex: int64(rowNum - 1),
+						EndIndex:   int64(rowNum),
+					},
+				},
+			},
+		},
+	}
+	_, err = b.srv.Spreadsheets.BatchUpdate(b.id, rq).Context(ctx).Do()
+	return err
+}
+
+// RebuildSummary はユーザーごとのシートから集計シートを作り直す
+// 作り直した集計行の数を返す
+func (c *Client) RebuildSummary(ctx context.Context) (int, error) {
+	books := map[*book]bool{c.root: true}
+	if c.layout == LayoutMonthlySpreadsheet {
+		periods, err := c.loadPeriods(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for period := range periods {
+			b, err := c.book(ctx, period, false)
+			if err != nil {
+				return 0, err
+			}
+			books[b] = true
+		}
+	}
+
+	total := 0
+	for b := range books {
+		n, err := c.rebuildBookSummary(ctx, b)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	slog.Info("Rebuilt attendance summary", slog.Int("rows", total))
+	return total, nil
+}
+
+func (c *Client) rebuildBookSummary(ctx context.Context, b *book) (int, error) {
+	if err := b.loadUserMap(ctx); err != nil {
+		return 0, err
+	}
+	if err := b.refreshSheets(ctx); err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	keys := make([]userKey, 0, len(b.userSheets))
+	for key := range b.userSheets {
+		keys = append(keys, key)
+	}
+	b.mu.Unlock()
+
+	var rows [][]interface{}
+	for _, key := range keys {
+		title, ok := b.mappedTitle(key)
+		if !ok {
+			continue
+		}
+		s := sheet{b, title}
+		records, err := s.readRecords(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", title, err)
+		}
+		valid := validRecords(records)
+		seen := map[string]bool{}
+		for _, r := range valid {
+			if seen[r.Date] {
+				continue
+			}
+			seen[r.Date] = true
+			if summary, ok := summarizeDay(valid, r.Date); ok {
+				rows = append(rows, summaryRow(key.userID, summaryName(s, key.period), summary))
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a[0] != b[0] {
+			return fmt.Sprint(a[0]) < fmt.Sprint(b[0])
+		}
+		return fmt.Sprint(a[2]) < fmt.Sprint(b[2])
+	})
+
+	b.summaryMu.Lock()
+	defer b.summaryMu.Unlock()
+	if err := b.ensureSheet(ctx, summarySheet, false, summaryHeader); err != nil {
+		return 0, err
+	}
+	if _, err := b.srv.Spreadsheets.Values.Clear(b.id, a1(summarySheet, "A2:H"), &sheets.ClearValuesRequest{}).Context(ctx).Do(); err != nil {
+		return 0, fmt.Errorf("集計シートのクリア失敗: %w", err)
+	}
+	if len(rows) > 0 {
+		vr := &sheets.ValueRange{Values: rows}
+		if _, err := b.srv.Spreadsheets.Values.Update(b.id, a1(summarySheet, "A2"), vr).ValueInputOption("RAW").Context(ctx).Do(); err != nil {
+			return 0, fmt.Errorf("集計シートの書き込み失敗: %w", err)
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,186 @@
+package spreadsheet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/slack-go/slack"
+)
+
+// userMapSheet はSlackユーザーID → シートIDの対応を保存する非表示シート
+// 表示名が変わってもシートIDで引くので、履歴が別シートに分かれない
+const userMapSheet = "_users"
+
+var userMapHeader = []interface{}{"ユーザーID", "シートID", "作成時のシート名", "期間"}
+
+// userKey はユーザーと期間（月別タブのときは "2006-01"、それ以外は空）の組
+type userKey struct {
+	userID string
+	period string
+}
+
+// loadUserMap は対応表シートを読み込んでキャッシュする。なければ非表示で作成する
+func (b *book) loadUserMap(ctx context.Context) error {
+	b.mu.Lock()
+	loaded := b.userSheets != nil
+	b.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	if err := b.ensureSheet(ctx, userMapSheet, true, userMapHeader); err != nil {
+		return err
+	}
+	values, err := b.readValues(ctx, userMapSheet, "A:D")
+	if err != nil {
+		return err
+	}
+	userSheets := map[userKey]int64{}
+	for i, row := range values {
+		if i == 0 || len(row) < 2 {
+			continue
+		}
+		id, err := strconv.ParseInt(fmt.Sprint(row[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		key := userKey{userID: fmt.Sprint(row[0])}
+		if len(row) > 3 {
+			key.period = fmt.Sprint(row[3])
+		}
+		userSheets[key] = id
+	}
+
+	b.mu.Lock()
+	b.userSheets = userSheets
+	b.mu.Unlock()
+	return nil
+}
+
+// mappedTitle はキャッシュだけを見て対応表に登録済みのシート名を返す
+func (b *book) mappedTitle(key userKey) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id, ok := b.userSheets[key]
+	if !ok {
+		return "", false
+	}
+	title, ok := b.sheetTitles[id]
+	return title, ok
+}
+
+// sheetOwner は対応表でシートIDに紐付いているユーザーIDを返す
+func (b *book) sheetOwner(sheetID int64) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, id := range b.userSheets {
+		if id == sheetID {
+			return key.userID
+		}
+	}
+	return ""
+}
+
+// userSheet はユーザーの指定期間のシートを返す
+// 対応表に未登録なら、表示名と同名の既存シートを引き継ぐか、createがtrueなら新規作成して登録する
+// シートがなくcreateがfalseなら false を返す
+func (c *Client) userSheet(ctx context.Context, userID, period string, create bool) (sheet, bool, error) {
+	b, err := c.book(ctx, period, create)
+	if err != nil || b == nil {
+		return sheet{}, false, err
+	}
+	if err := b.loadUserMap(ctx); err != nil {
+		return sheet{}, false, err
+	}
+
+	key := userKey{userID: userID}
+	if c.layout == LayoutMonthlyTab {
+		key.period = period
+	}
+	if title, ok := b.mappedTitle(key); ok {
+		return sheet{b, title}, true, nil
+	}
+
+	// 同じユーザーのシートが並行して作られないように直列化する
+	b.resolveMu.Lock()
+	defer b.resolveMu.Unlock()
+
+	b.mu.Lock()
+	sheetID, mapped := b.userSheets[key]
+	b.mu.Unlock()
+	if mapped {
+		// シート名が手動で変更されていてもIDで引き直せる
+		title, ok, err := b.sheetTitle(ctx, sheetID)
+		if err != nil {
+			return sheet{}, false, err
+		}
+		if ok {
+			return sheet{b, title}, true, nil
+		}
+		// 対応表にあるシートが手動で削除されていた場合は作り直す
+	}
+
+	name, err := c.displayName(userID)
+	if err != nil {
+		return sheet{}, false, err
+	}
+	if key.period != "" {
+		name += " " + key.period
+	}
+
+	id, exists, err := b.sheetByTitle(ctx, name)
+	if err != nil {
+		return sheet{}, false, err
+	}
+	if exists && b.sheetOwner(id) != "" {
+		// 同名の別ユーザーがいるのでユーザーIDで区別する
+		name = fmt.Sprintf("%s (%s)", name, userID)
+		id, exists, err = b.sheetByTitle(ctx, name)
+		if err != nil {
+			return sheet{}, false, err
+		}
+	}
+	if !exists {
+		if !create {
+			return sheet{}, false, nil
+		}
+		id, err = b.createSheetWithHeader(ctx, name, false, header)
+		if err != nil {
+			return sheet{}, false, err
+		}
+	}
+
+	if err := b.mapUserSheet(ctx, key, id, name); err != nil {
+		return sheet{}, false, err
+	}
+	return sheet{b, name}, true, nil
+}
+
+// mapUserSheet はユーザーとシートの対応を対応表に追加する
+func (b *book) mapUserSheet(ctx context.Context, key userKey, id int64, title string) error {
+	row := []interface{}{key.userID, strconv.FormatInt(id, 10), title, key.period}
+	if _, err := b.appendRow(ctx, userMapSheet, row); err != nil {
+		return fmt.Errorf("ユーザー対応表の更新失敗: %w", err)
+	}
+	b.mu.Lock()
+	b.userSheets[key] = id
+	b.mu.Unlock()
+	return nil
+}
+
+// displayName はシートを新規作成するときの名前を返す
+func (c *Client) displayName(userID string) (string, error) {
+	profile, err := c.slackClient.GetUserProfile(&slack.GetUserProfileParameters{UserID: userID})
+	if err != nil {
+		return "", fmt.Errorf("Slackユーザープロフィール取得失敗: %w", err)
+	}
+	name := profile.FirstName + profile.LastName
+	if name == "" {
+		name = profile.RealName // fallback
+	}
+	if name == "" {
+		name = userID // fallback
+	}
+	return name, nil
+}
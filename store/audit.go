@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// auditKey is the stream of every audit entry of the workspace
+	auditKey = "audit"
+	// auditMaxLen and auditUserMaxLen bound the streams; trimming is approximate
+	auditMaxLen     = 100000
+	auditUserMaxLen = 1000
+)
+
+// AppendAudit appends an entry to the audit stream and to the stream of each user it concerns
+func (r *RedisClient) AppendAudit(ctx context.Context, userIDs []string, data string) error {
+	// not a transaction: the streams may live on different Cluster nodes
+	pipe := r.client.Pipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.key(auditKey),
+		MaxLen: auditMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": data},
+	})
+	for _, uid := range userIDs {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: r.key(auditKey + ":" + uid),
+			MaxLen: auditUserMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"data": data},
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// AuditHistory returns the latest audit entries concerning a user, newest first
+func (r *RedisClient) AuditHistory(ctx context.Context, uid string, count int64) ([]string, error) {
+	msgs, err := r.client.XRevRangeN(ctx, r.key(auditKey+":"+uid), "+", "-", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		if data, ok := m.Values["data"].(string); ok {
+			entries = append(entries, data)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+const dedupPrefix = "dedup:"
+
+// FirstSeen reports whether id is seen for the first time within ttl, and remembers it.
+// Slack redelivers envelopes, events and interactions it did not see acknowledged in time,
+// so the transports use it to handle each delivery only once.
+// The key is shared by all teams because the IDs are unique across workspaces.
+func (r *RedisClient) FirstSeen(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.shared(dedupPrefix+id), "1", ttl).Result()
+}
+
+// ForgetSeen forgets id, so that FirstSeen reports it as first again.
+// It releases a claim taken with FirstSeen when the work it guarded failed.
+func (r *RedisClient) ForgetSeen(ctx context.Context, id string) error {
+	return r.client.Del(ctx, r.shared(dedupPrefix+id)).Err()
+}
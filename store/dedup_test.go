@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFirstSeenAndForget(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		seen := func(id string) bool {
+			t.Helper()
+			first, err := s.FirstSeen(ctx, id, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return first
+		}
+		if !seen("record:a") {
+			t.Fatal("first FirstSeen = false")
+		}
+		if seen("record:a") {
+			t.Fatal("second FirstSeen = true")
+		}
+		if !seen("record:b") {
+			t.Fatal("FirstSeen of another id = false")
+		}
+		// the key is shared by the teams
+		if first, err := s.ForTeam("T0123").FirstSeen(ctx, "record:a", time.Hour); err != nil || first {
+			t.Fatalf("FirstSeen from another team = %v, %v", first, err)
+		}
+		if err := s.ForgetSeen(ctx, "record:a"); err != nil {
+			t.Fatal(err)
+		}
+		if !seen("record:a") {
+			t.Fatal("FirstSeen after ForgetSeen = false")
+		}
+		if err := s.ForgetSeen(ctx, "record:unknown"); err != nil {
+			t.Fatalf("ForgetSeen of an unknown id: %v", err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedis returns a client of an in-memory Redis server that is shut down with the test
+func newTestRedis(t testing.TB) (*RedisClient, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r, err := NewRedisClient(Options{URL: "redis://" + mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, mr
+}
+
+// newTestSQLite returns a store on a database file in a temporary directory
+func newTestSQLite(t testing.TB) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "afk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// eachStore runs fn against a Redis and a SQLite store
+func eachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("redis", func(t *testing.T) {
+		r, _ := newTestRedis(t)
+		fn(t, r)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, newTestSQLite(t))
+	})
+}
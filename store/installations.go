@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// installationsKey is a hash of team ID → Installation JSON, shared by all workspaces
+	installationsKey = "installations"
+	// oauthStatePrefix prefixes the state parameters issued by the install endpoint
+	oauthStatePrefix = "oauth-state:"
+)
+
+// Installation is the bot token of a workspace that installed the app through OAuth
+type Installation struct {
+	TeamID      string    `json:"team_id"`
+	TeamName    string    `json:"team_name"`
+	BotToken    string    `json:"bot_token"`
+	BotUserID   string    `json:"bot_user_id"`
+	InstalledAt time.Time `json:"installed_at"`
+}
+
+// SaveInstallation stores or replaces the installation of a team
+func (r *RedisClient) SaveInstallation(ctx context.Context, inst Installation) error {
+	data, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, r.shared(installationsKey), inst.TeamID, string(data)).Err()
+}
+
+// GetInstallation returns the installation of a team, or nil when the team has not installed the app
+func (r *RedisClient) GetInstallation(ctx context.Context, teamID string) (*Installation, error) {
+	val, err := r.client.HGet(ctx, r.shared(installationsKey), teamID).Result()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var inst Installation
+	if err := json.Unmarshal([]byte(val), &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// DeleteInstallation forgets the bot token of a team
+func (r *RedisClient) DeleteInstallation(ctx context.Context, teamID string) error {
+	return r.client.HDel(ctx, r.shared(installationsKey), teamID).Err()
+}
+
+// SaveOAuthState remembers a state parameter of the install flow for ttl
+func (r *RedisClient) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	return r.client.Set(ctx, r.shared(oauthStatePrefix+state), "1", ttl).Err()
+}
+
+// ConsumeOAuthState reports whether state was issued and not used yet, and invalidates it
+func (r *RedisClient) ConsumeOAuthState(ctx context.Context, state string) (bool, error) {
+	n, err := r.client.Del(ctx, r.shared(oauthStatePrefix+state)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,386 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// migrationsKey is the set of migration IDs already applied to this Redis
+const migrationsKey = "migrations"
+
+// MigrationEnv is what migrations need to know about the deployment
+type MigrationEnv struct {
+	// LegacyTeamID is the team of SLACK_BOT_TOKEN, which owns the keys written before multi-workspace support
+	LegacyTeamID string
+	// LegacyKeys opts in to moving those keys under LegacyTeamID. Finding them scans every key of the
+	// Redis, which may be shared with other applications, so it only runs when asked for
+	// (AFK_MIGRATE_LEGACY_KEYS or migrate --legacy-keys).
+	LegacyKeys bool
+}
+
+// errMigrationSkipped is returned by a migration that did not run. It is not recorded as applied,
+// so it runs on a later start.
+var errMigrationSkipped = errors.New("migration skipped")
+
+// Migration is a one-off data migration of the Redis store.
+// Migrations run in order and each one runs only once.
+type Migration struct {
+	ID  string
+	Run func(ctx context.Context, r *RedisClient, env MigrationEnv) error
+}
+
+var migrations = []Migration{
+	{ID: "20261018-namespace-keys-by-team", Run: namespaceLegacyKeys},
+	{ID: "20261018-registered-list-to-set", Run: registeredListToSet},
+	{ID: "20261018-hash-tag-user-keys", Run: hashTagUserKeys},
+}
+
+// Migrate runs the migrations that have not been applied yet and returns their IDs.
+// When REDIS_KEY_PREFIX is set for the first time, the keys written without it are moved under it first.
+func (r *RedisClient) Migrate(ctx context.Context, env MigrationEnv) ([]string, error) {
+	if r.base != "" {
+		if err := r.adoptUnprefixedKeys(ctx); err != nil {
+			return nil, fmt.Errorf("failed to apply REDIS_KEY_PREFIX: %w", err)
+		}
+	}
+	var applied []string
+	for _, m := range migrations {
+		done, err := r.client.SIsMember(ctx, r.shared(migrationsKey), m.ID).Result()
+		if err != nil {
+			return applied, err
+		}
+		if done {
+			continue
+		}
+
+		slog.Info("Running store migration", slog.String("id", m.ID))
+		err = m.Run(ctx, r, env)
+		if errors.Is(err, errMigrationSkipped) {
+			continue
+		}
+		if err != nil {
+			return applied, fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+		if err := r.client.SAdd(ctx, r.shared(migrationsKey), m.ID).Err(); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m.ID)
+	}
+	return applied, nil
+}
+
+// legacyKeyPattern matches the per-user keys of a single-workspace deployment: "<uid>" and "<uid>-store"
+var legacyKeyPattern = regexp.MustCompile(`^([UW][A-Z0-9]+)(-store)?$`)
+
+// legacyUserPattern matches the members of the legacy "registered" list
+var legacyUserPattern = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+
+// namespaceLegacyKeys moves "registered", "<uid>" and "<uid>-store" under the legacy team's prefix,
+// straight to their current names, so that it gives the same result when it runs after the later migrations.
+// Only keys whose value is this bot's are moved: the registered list of user IDs, presence records,
+// and the auto-response of a user found in one of them. Expiry is kept because RENAME preserves the TTL.
+func namespaceLegacyKeys(ctx context.Context, r *RedisClient, env MigrationEnv) error {
+	if !env.LegacyKeys {
+		n, err := r.client.Exists(ctx, r.shared("registered")).Result()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			slog.Warn("Found keys of a single-workspace deployment; set AFK_MIGRATE_LEGACY_KEYS=true or run migrate --legacy-keys to move them under the team of SLACK_BOT_TOKEN")
+		}
+		return errMigrationSkipped
+	}
+	if env.LegacyTeamID == "" {
+		return errors.New("moving legacy keys needs the team of SLACK_BOT_TOKEN; set SLACK_BOT_TOKEN")
+	}
+
+	keys, err := r.scanKeys(ctx, r.shared("*"))
+	if err != nil {
+		return err
+	}
+	found, err := r.findLegacyKeys(ctx, keys, r.base)
+	if err != nil {
+		return err
+	}
+	legacyTeam := r.team(env.LegacyTeamID)
+	renames := map[string]string{}
+	for uid, key := range found.presence {
+		renames[key] = legacyTeam.presenceKey(uid)
+	}
+	for uid, key := range found.messages {
+		renames[key] = legacyTeam.key(uid)
+	}
+	if err := r.renameKeys(ctx, renames); err != nil {
+		return err
+	}
+	registered := found.registered != ""
+	if registered {
+		list := legacyTeam.key("registered")
+		if err := r.renameKeys(ctx, map[string]string{found.registered: list}); err != nil {
+			return err
+		}
+		if err := r.listToSet(ctx, list, legacyTeam.key(registeredKey)); err != nil {
+			return err
+		}
+	}
+	slog.Info("Namespaced legacy keys", slog.String("team", env.LegacyTeamID), slog.Int("keys", len(renames)), slog.Bool("registered", registered))
+	return nil
+}
+
+// legacyKeys are the keys of a single-workspace deployment, with values in this bot's format
+type legacyKeys struct {
+	registered string            // the "registered" list of user IDs, empty if there is none
+	presence   map[string]string // uid → "<uid>-store" holding a presence record
+	messages   map[string]string // uid → "<uid>" holding the auto-response of a user in one of the above
+}
+
+// findLegacyKeys picks the legacy keys out of keys, which are named under base.
+// Keys that match a legacy name but hold something else are logged and left out.
+func (r *RedisClient) findLegacyKeys(ctx context.Context, keys []string, base string) (*legacyKeys, error) {
+	found := &legacyKeys{presence: map[string]string{}, messages: map[string]string{}}
+	users := map[string]bool{}
+	messages := map[string]string{}
+	for _, key := range keys {
+		name, ok := strings.CutPrefix(key, base)
+		if !ok {
+			continue
+		}
+		if name == "registered" {
+			ok, err := r.isLegacyRegistered(ctx, key, users)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				slog.Warn("Left key that is not a list of user IDs", slog.String("key", key))
+				continue
+			}
+			found.registered = key
+			continue
+		}
+		m := legacyKeyPattern.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		uid := m[1]
+		if m[2] == "" {
+			messages[uid] = key
+			continue
+		}
+		ok, err := r.isLegacyValue(ctx, key, isPresenceRecord)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			slog.Warn("Left key that is not a presence record", slog.String("key", key))
+			continue
+		}
+		users[uid] = true
+		found.presence[uid] = key
+	}
+	for uid, key := range messages {
+		ok, err := r.isLegacyValue(ctx, key, isMessage)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !users[uid] {
+			slog.Warn("Left key that is not the auto-response of a known user", slog.String("key", key))
+			continue
+		}
+		found.messages[uid] = key
+	}
+	return found, nil
+}
+
+// isLegacyRegistered reports whether key is a list of user IDs, and adds them to users
+func (r *RedisClient) isLegacyRegistered(ctx context.Context, key string, users map[string]bool) (bool, error) {
+	kind, err := r.client.Type(ctx, key).Result()
+	if err != nil || kind != "list" {
+		return false, err
+	}
+	members, err := r.client.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, uid := range members {
+		if !legacyUserPattern.MatchString(uid) {
+			return false, nil
+		}
+	}
+	for _, uid := range members {
+		users[uid] = true
+	}
+	return true, nil
+}
+
+// isLegacyValue reports whether key is a string that valid accepts. A key that expired meanwhile is not.
+func (r *RedisClient) isLegacyValue(ctx context.Context, key string, valid func(string) bool) (bool, error) {
+	kind, err := r.client.Type(ctx, key).Result()
+	if err != nil || kind != "string" {
+		return false, err
+	}
+	val, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return valid(val), nil
+}
+
+// presenceFields are the fields of which a presence record of any schema has at least one
+var presenceFields = []string{"version", "today_begin", "today_end", "last_active_start_time", "last_lunch_date", "mention_history"}
+
+// isPresenceRecord reports whether val decodes as a presence record of this bot
+func isPresenceRecord(val string) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(val), &fields); err != nil {
+		return false
+	}
+	if _, err := decodePresence([]byte(val)); err != nil {
+		return false
+	}
+	for _, f := range presenceFields {
+		if _, ok := fields[f]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMessage reports whether val can be an auto-response: text that is not a presence record
+func isMessage(val string) bool {
+	return utf8.ValidString(val) && !isPresenceRecord(val)
+}
+
+// userKeyPattern matches the presence and mention keys written before their user ID became a hash tag
+var userKeyPattern = regexp.MustCompile(`^([TE][A-Z0-9]+:)([UW][A-Z0-9]+)-(store|mentions)$`)
+
+// hashTagUserKeys renames "<team>:<uid>-store" to "<team>:{<uid>}-store" (and the mention lists likewise)
+func hashTagUserKeys(ctx context.Context, r *RedisClient, env MigrationEnv) error {
+	renames := map[string]string{}
+	for _, pattern := range []string{"*-store", "*-mentions"} {
+		keys, err := r.scanKeys(ctx, r.shared(pattern))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			name := strings.TrimPrefix(key, r.base)
+			if userKeyPattern.MatchString(name) {
+				renames[key] = r.shared(userKeyPattern.ReplaceAllString(name, "$1{$2}-$3"))
+			}
+		}
+	}
+	if len(renames) > 0 {
+		slog.Info("Hash-tagging user keys", slog.Int("keys", len(renames)))
+	}
+	return r.renameKeys(ctx, renames)
+}
+
+// ownKeyPattern matches the keys this bot writes without REDIS_KEY_PREFIX
+var ownKeyPattern = regexp.MustCompile(`^(registered|registered-users|installations|migrations|(oauth-state|dedup):.+|[TE][A-Z0-9]{6,}:.+|[UW][A-Z0-9]+(-store)?)$`)
+
+// adoptUnprefixedKeys moves the keys written before REDIS_KEY_PREFIX was set under the prefix.
+// It only runs when the prefixed store has not been migrated yet. When the unprefixed one has,
+// its migrations set tells that the keys of ownKeyPattern are this bot's; otherwise the keys are those
+// of a deployment that never ran a migration, and adoptBaselineKeys checks their values instead.
+// Either way the keys of other applications sharing the Redis are left alone.
+func (r *RedisClient) adoptUnprefixedKeys(ctx context.Context) error {
+	prefixed, err := r.client.Exists(ctx, r.shared(migrationsKey)).Result()
+	if err != nil || prefixed > 0 {
+		return err
+	}
+	unprefixed, err := r.client.Exists(ctx, migrationsKey).Result()
+	if err != nil {
+		return err
+	}
+	if unprefixed == 0 {
+		return r.adoptBaselineKeys(ctx)
+	}
+
+	keys, err := r.scanKeys(ctx, "*")
+	if err != nil {
+		return err
+	}
+	renames := map[string]string{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, r.base) && ownKeyPattern.MatchString(key) {
+			renames[key] = r.base + key
+		}
+	}
+	// migrations last, so that an interrupted run is picked up again on the next start
+	delete(renames, migrationsKey)
+	if err := r.renameKeys(ctx, renames); err != nil {
+		return err
+	}
+	if err := r.renameKeys(ctx, map[string]string{migrationsKey: r.shared(migrationsKey)}); err != nil {
+		return err
+	}
+	slog.Info("Moved keys under REDIS_KEY_PREFIX", slog.String("prefix", r.base), slog.Int("keys", len(renames)+1))
+	return nil
+}
+
+// adoptBaselineKeys moves the keys of a single-workspace deployment that never ran a migration
+// (the Ruby bot and the Go versions before multi-workspace support) under the prefix, keeping their names.
+// Only values in this bot's format are moved; namespaceLegacyKeys then moves them under the team.
+func (r *RedisClient) adoptBaselineKeys(ctx context.Context) error {
+	keys, err := r.scanKeys(ctx, "*")
+	if err != nil {
+		return err
+	}
+	var unprefixed []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, r.base) {
+			unprefixed = append(unprefixed, key)
+		}
+	}
+	found, err := r.findLegacyKeys(ctx, unprefixed, "")
+	if err != nil {
+		return err
+	}
+	renames := map[string]string{}
+	if found.registered != "" {
+		renames[found.registered] = r.shared(found.registered)
+	}
+	for _, key := range found.presence {
+		renames[key] = r.shared(key)
+	}
+	for _, key := range found.messages {
+		renames[key] = r.shared(key)
+	}
+	if len(renames) == 0 {
+		return nil
+	}
+	if err := r.renameKeys(ctx, renames); err != nil {
+		return err
+	}
+	slog.Info("Moved keys of a single-workspace deployment under REDIS_KEY_PREFIX", slog.String("prefix", r.base), slog.Int("keys", len(renames)))
+	return nil
+}
+
+// renameKeys renames each key unless the new name is taken. Keys that expired meanwhile are skipped,
+// and RENAME keeps the TTL of the others.
+func (r *RedisClient) renameKeys(ctx context.Context, renames map[string]string) error {
+	for from, to := range renames {
+		renamed, err := r.client.RenameNX(ctx, from, to).Result()
+		if err != nil && strings.Contains(err.Error(), "no such key") {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rename %s: %w", from, err)
+		}
+		if !renamed {
+			slog.Warn("Kept old key because the new key already exists", slog.String("key", from), slog.String("new", to))
+			continue
+		}
+		slog.Info("Renamed key", slog.String("key", from), slog.String("new", to))
+	}
+	return nil
+}
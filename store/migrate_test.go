@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestNamespaceLegacyKeys(t *testing.T) {
+	r, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	// a single-workspace deployment of the Ruby bot, and keys of another application
+	mr.Set("U0001-store", `{"today_begin":"2026-10-16 09:00:00 +0900","mention_history":{}}`)
+	mr.Set("U0001", "休憩中です")
+	mr.SetTTL("U0001", time.Hour)
+	mr.Set("U0002-store", `{"version":3,"status":"afk"}`)
+	mr.Push("registered", "U0001", "U0003")
+	mr.Set("UPLOADS", "not ours")               // looks like an auto-response, but no user has it
+	mr.Set("WORKER7-store", `{"queue":"jobs"}`) // JSON, but not a presence record
+	mr.Set("U0009-store", "plain text")
+	mr.Set("U0003", `{"version":3}`) // a registered user, but the value is not a message
+
+	env := MigrationEnv{LegacyTeamID: "T0001"}
+	applied, err := r.Migrate(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20261018-registered-list-to-set", "20261018-hash-tag-user-keys"}; !reflect.DeepEqual(applied, want) {
+		t.Fatalf("applied without opting in = %v, want %v", applied, want)
+	}
+	if !mr.Exists("U0001-store") || !mr.Exists("registered") {
+		t.Fatal("legacy keys were moved without opting in")
+	}
+
+	env.LegacyKeys = true
+	applied, err = r.Migrate(ctx, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20261018-namespace-keys-by-team"}; !reflect.DeepEqual(applied, want) {
+		t.Fatalf("applied after opting in = %v, want %v", applied, want)
+	}
+
+	team := r.ForTeam("T0001")
+	p, err := team.GetUserPresence("U0001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Begin.IsZero() {
+		t.Error("presence of U0001 was not moved")
+	}
+	if p, _ := team.GetUserPresence("U0002"); p.Status != StatusAfk {
+		t.Errorf("presence of U0002 = %+v", p)
+	}
+	if msg, err := team.Get("U0001"); err != nil || msg != "休憩中です" {
+		t.Errorf("auto-response of U0001 = %q, %v", msg, err)
+	}
+	if ttl, ok, err := team.TTL("U0001"); err != nil || !ok || ttl <= 0 {
+		t.Errorf("TTL of the auto-response = %v, %v, %v", ttl, ok, err)
+	}
+	users, err := team.RegisteredUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"U0001", "U0003"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("registered = %v, want %v", users, want)
+	}
+	for _, key := range []string{"UPLOADS", "WORKER7-store", "U0009-store", "U0003"} {
+		if !mr.Exists(key) {
+			t.Errorf("%s was moved", key)
+		}
+	}
+	for _, key := range []string{"U0001-store", "U0001", "U0002-store", "registered"} {
+		if mr.Exists(key) {
+			t.Errorf("%s was left", key)
+		}
+	}
+}
+
+func TestPresenceAndMessageValues(t *testing.T) {
+	tests := []struct {
+		val      string
+		presence bool
+		message  bool
+	}{
+		{`{"version":3,"status":"afk"}`, true, false},
+		{`{"today_end":"2026-10-16T18:00:00+09:00"}`, true, false},
+		{`{"version":99}`, false, true},
+		{`{"queue":"jobs"}`, false, true},
+		{`[1,2]`, false, true},
+		{"ランチに行ってきます", false, true},
+		{"\xff\xfe", false, false},
+	}
+	for _, tt := range tests {
+		if got := isPresenceRecord(tt.val); got != tt.presence {
+			t.Errorf("isPresenceRecord(%q) = %v, want %v", tt.val, got, tt.presence)
+		}
+		if got := isMessage(tt.val); got != tt.message {
+			t.Errorf("isMessage(%q) = %v, want %v", tt.val, got, tt.message)
+		}
+	}
+}
+
+// newPrefixedRedis returns a client with REDIS_KEY_PREFIX on the Redis of mr
+func newPrefixedRedis(t *testing.T, mr *miniredis.Miniredis, prefix string) *RedisClient {
+	t.Helper()
+	r, err := NewRedisClient(Options{URL: "redis://" + mr.Addr(), KeyPrefix: prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestAdoptUnprefixedKeys(t *testing.T) {
+	_, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	// a multi-workspace deployment that ran its migrations without a prefix
+	mr.SAdd("migrations", "20261018-namespace-keys-by-team")
+	mr.Set("T0123ABCD:{U0001}-store", `{"version":3,"status":"afk"}`)
+	mr.SAdd("T0123ABCD:registered-users", "U0001")
+	mr.Set("installations", "{}")
+	mr.Set("sessions:abc", "another application")
+
+	r := newPrefixedRedis(t, mr, "afk:")
+	if _, err := r.Migrate(ctx, MigrationEnv{LegacyTeamID: "T0123ABCD"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := r.ForTeam("T0123ABCD").GetUserPresence("U0001"); p.Status != StatusAfk {
+		t.Errorf("presence after adopting = %+v", p)
+	}
+	if users, _ := r.ForTeam("T0123ABCD").RegisteredUsers(); len(users) != 1 {
+		t.Errorf("registered after adopting = %v", users)
+	}
+	if !mr.Exists("sessions:abc") || mr.Exists("afk:sessions:abc") {
+		t.Error("a key of another application was moved")
+	}
+	for _, key := range []string{"migrations", "installations", "T0123ABCD:{U0001}-store"} {
+		if mr.Exists(key) {
+			t.Errorf("%s was left without the prefix", key)
+		}
+	}
+}
+
+func TestAdoptBaselineKeys(t *testing.T) {
+	_, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	// the baseline bot never wrote a migrations set
+	mr.Set("U0001-store", `{"today_begin":"2026-10-16 09:00:00 +0900","mention_history":{}}`)
+	mr.Set("U0001", "休憩中です")
+	mr.SetTTL("U0001", time.Hour)
+	mr.Push("registered", "U0001", "U0002")
+	mr.Set("UPLOADS", "not ours")
+	mr.Set("WORKER7-store", `{"queue":"jobs"}`)
+	mr.Set("sessions:abc", "another application")
+
+	r := newPrefixedRedis(t, mr, "afk:")
+	if _, err := r.Migrate(ctx, MigrationEnv{LegacyTeamID: "T0001"}); err != nil {
+		t.Fatal(err)
+	}
+	for key, moved := range map[string]bool{
+		"U0001-store":   true,
+		"U0001":         true,
+		"registered":    true,
+		"UPLOADS":       false,
+		"WORKER7-store": false,
+		"sessions:abc":  false,
+	} {
+		if mr.Exists(key) == moved || mr.Exists("afk:"+key) != moved {
+			t.Errorf("%s moved under the prefix = %v, want %v", key, !mr.Exists(key), moved)
+		}
+	}
+	if ttl := mr.TTL("afk:U0001"); ttl <= 0 {
+		t.Errorf("TTL of the adopted auto-response = %v", ttl)
+	}
+
+	// moving them under the team is the opt-in legacy key migration, as without a prefix
+	if _, err := r.Migrate(ctx, MigrationEnv{LegacyTeamID: "T0001", LegacyKeys: true}); err != nil {
+		t.Fatal(err)
+	}
+	team := r.ForTeam("T0001")
+	if p, _ := team.GetUserPresence("U0001"); p.Begin.IsZero() {
+		t.Errorf("presence after the legacy migration = %+v", p)
+	}
+	if msg, err := team.Get("U0001"); err != nil || msg != "休憩中です" {
+		t.Errorf("auto-response after the legacy migration = %q, %v", msg, err)
+	}
+	if users, _ := team.RegisteredUsers(); !reflect.DeepEqual(users, []string{"U0001", "U0002"}) {
+		t.Errorf("registered after the legacy migration = %v", users)
+	}
+}
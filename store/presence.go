@@ -0,0 +1,315 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PresenceVersion is the schema version written to "{<uid>}-store".
+// Records without a version are from before the schema existed (the Ruby bot and early Go versions)
+// and are converted by decodeLegacyPresence when read; the next write stores them in the current schema.
+// Version 2 kept the mentions in the record; since version 3 they are in the "{<uid>}-mentions" list.
+const PresenceVersion = 3
+
+const (
+	// presenceTTL keeps a presence record and its mentions for a month after the last update
+	presenceTTL = 30 * 24 * time.Hour
+	// maxMentions bounds the mentions kept for one user
+	maxMentions = 100
+	// maxTxRetries is how often an update is retried when another one changed the record first
+	maxTxRetries = 10
+)
+
+// Status is what a user set with the last command
+type Status string
+
+const (
+	StatusWorking Status = "working"
+	StatusAfk     Status = "afk"
+	StatusLunch   Status = "lunch"
+	StatusFinish  Status = "finish"
+	StatusBack    Status = "back"
+)
+
+// UserPresence is the record kept per user in "{<uid>}-store".
+// The auto-response itself lives in the "<uid>" key, whose TTL ends it; Status and ReturnAt
+// describe what was set last and are not cleared when that key expires.
+// The mentions received while away are kept apart in "{<uid>}-mentions" so that appending one
+// never has to rewrite the record (see AddMention and TakeMentions).
+type UserPresence struct {
+	Version  int       `json:"version"`
+	Status   Status    `json:"status,omitempty"`
+	Message  string    `json:"message,omitempty"`  // auto-response text
+	Since    time.Time `json:"since"`              // when Status was set
+	ReturnAt time.Time `json:"return_at"`          // when the auto-response ends, zero if it doesn't
+	Begin    time.Time `json:"begin"`              // last /start
+	End      time.Time `json:"end"`                // last /finish
+	Lunch    time.Time `json:"lunch"`              // last /lunch
+	Delegate string    `json:"delegate,omitempty"` // user ID to contact instead
+	Location string    `json:"location,omitempty"` // work location given to the last /start
+	Plan     string    `json:"plan,omitempty"`     // plan entered with the last /start --plan
+
+	clearMentions bool // set by SetStatus; UpdateUserPresence deletes the mention list with the record
+}
+
+// storedPresence is UserPresence as read from Redis, with the mentions older schemas kept inside the record
+type storedPresence struct {
+	UserPresence
+	Mentions []Mention `json:"mentions,omitempty"`
+}
+
+// Mention is a message that mentioned a user while the auto-response was on
+type Mention struct {
+	Channel string `json:"channel"`
+	User    string `json:"user"`
+	Text    string `json:"text"`
+	EventTS string `json:"event_ts"`
+}
+
+// SetStatus records a new status and its auto-response, and forgets the mentions of the previous one.
+// returnAt is zero when the auto-response has no end.
+func (p *UserPresence) SetStatus(status Status, message string, now, returnAt time.Time) {
+	p.Status = status
+	p.Message = message
+	p.Since = now
+	p.ReturnAt = returnAt
+	p.clearMentions = true
+}
+
+// The user ID in the presence and mention keys is a hash tag, so that both land in the same
+// Redis Cluster slot and can be updated in one transaction.
+func (r *RedisClient) presenceKey(uid string) string {
+	return r.key("{" + uid + "}-store")
+}
+
+func (r *RedisClient) mentionsKey(uid string) string {
+	return r.key("{" + uid + "}-mentions")
+}
+
+// GetUserPresence reads the presence of uid. A user without a record gets an empty one.
+func (r *RedisClient) GetUserPresence(uid string) (*UserPresence, error) {
+	stored, err := readPresence(r.client, r.presenceKey(uid))
+	if err != nil {
+		return nil, err
+	}
+	return &stored.UserPresence, nil
+}
+
+// UpdateUserPresence applies fn to the presence of uid and stores the result atomically.
+// When another update changes the record between the read and the write, the update is retried with
+// the new record, so fn must not have side effects. Mentions kept in the record by an older schema are
+// moved to the mention list in the same transaction.
+func (r *RedisClient) UpdateUserPresence(uid string, fn func(p *UserPresence) error) error {
+	key, mentionsKey := r.presenceKey(uid), r.mentionsKey(uid)
+	return r.watch(func(tx *redis.Tx) error {
+		stored, err := readPresence(tx, key)
+		if err != nil {
+			return err
+		}
+		p := stored.UserPresence
+		if err := fn(&p); err != nil {
+			return err
+		}
+		data, err := encodePresence(&p)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, presenceTTL)
+			if p.clearMentions {
+				pipe.Del(ctx, mentionsKey)
+			} else if len(stored.Mentions) > 0 {
+				return pushMentions(pipe, mentionsKey, stored.Mentions)
+			}
+			return nil
+		})
+		return err
+	}, key, mentionsKey)
+}
+
+// AddMention appends a mention to the list of uid. Concurrent calls never overwrite each other.
+func (r *RedisClient) AddMention(uid string, m Mention) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return pushMentions(pipe, r.mentionsKey(uid), []Mention{m})
+	})
+	return err
+}
+
+// TakeMentions returns the mentions of uid in the order they arrived and empties the list,
+// including those an older schema kept in the presence record
+func (r *RedisClient) TakeMentions(uid string) ([]Mention, error) {
+	key, mentionsKey := r.presenceKey(uid), r.mentionsKey(uid)
+	var taken []Mention
+	err := r.watch(func(tx *redis.Tx) error {
+		stored, err := readPresence(tx, key)
+		if err != nil {
+			return err
+		}
+		raw, err := tx.LRange(ctx, mentionsKey, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		taken = append([]Mention(nil), stored.Mentions...)
+		for _, item := range raw {
+			var m Mention
+			if err := json.Unmarshal([]byte(item), &m); err != nil {
+				return err
+			}
+			taken = append(taken, m)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, mentionsKey)
+			if len(stored.Mentions) > 0 {
+				data, err := encodePresence(&stored.UserPresence)
+				if err != nil {
+					return err
+				}
+				pipe.Set(ctx, key, data, presenceTTL)
+			}
+			return nil
+		})
+		return err
+	}, key, mentionsKey)
+	return taken, err
+}
+
+// watch runs fn in a WATCH transaction on keys, retrying while other clients change them first
+func (r *RedisClient) watch(fn func(tx *redis.Tx) error, keys ...string) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := r.client.Watch(ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("update of %v conflicted %d times", keys, maxTxRetries)
+}
+
+func pushMentions(pipe redis.Pipeliner, key string, mentions []Mention) error {
+	values := make([]interface{}, len(mentions))
+	for i, m := range mentions {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		values[i] = string(data)
+	}
+	pipe.RPush(ctx, key, values...)
+	pipe.LTrim(ctx, key, -maxMentions, -1)
+	pipe.Expire(ctx, key, presenceTTL)
+	return nil
+}
+
+// readPresence reads the record at key with c, which may be the client or a transaction
+func readPresence(c redis.Cmdable, key string) (*storedPresence, error) {
+	val, err := c.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return &storedPresence{UserPresence: UserPresence{Version: PresenceVersion, Since: time.Now()}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodePresence([]byte(val))
+}
+
+func encodePresence(p *UserPresence) (string, error) {
+	p.Version = PresenceVersion
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+func decodePresence(data []byte) (*storedPresence, error) {
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	switch {
+	case head.Version == 0:
+		return decodeLegacyPresence(data)
+	case head.Version > PresenceVersion:
+		return nil, fmt.Errorf("presence schema version %d is newer than this binary (%d)", head.Version, PresenceVersion)
+	}
+	var p storedPresence
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// decodeLegacyPresence reads the untyped records written before PresenceVersion.
+// Early Go versions wrote RFC 3339 times; the Ruby bot wrote Time#to_s ("2006-01-02 15:04:05 +0900")
+// or epoch seconds, and an empty mention_history as a hash ({}).
+func decodeLegacyPresence(data []byte) (*storedPresence, error) {
+	var legacy map[string]interface{}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, err
+	}
+	p := &storedPresence{UserPresence: UserPresence{
+		Version: PresenceVersion,
+		Since:   legacyTime(legacy["last_active_start_time"]),
+		Begin:   legacyTime(legacy["today_begin"]),
+		End:     legacyTime(legacy["today_end"]),
+		Lunch:   legacyTime(legacy["last_lunch_date"]),
+	}}
+
+	var history []interface{}
+	switch h := legacy["mention_history"].(type) {
+	case []interface{}:
+		history = h
+	case map[string]interface{}:
+		for _, m := range h {
+			history = append(history, m)
+		}
+	}
+	for _, item := range history {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p.Mentions = append(p.Mentions, Mention{
+			Channel: legacyString(m["channel"]),
+			User:    legacyString(m["user"]),
+			Text:    legacyString(m["text"]),
+			EventTS: legacyString(m["event_ts"]),
+		})
+	}
+	return p, nil
+}
+
+var legacyTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+}
+
+func legacyTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case string:
+		for _, layout := range legacyTimeLayouts {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed
+			}
+		}
+		if sec, err := strconv.ParseFloat(t, 64); err == nil {
+			return time.Unix(int64(sec), 0)
+		}
+	case float64:
+		return time.Unix(int64(t), 0)
+	}
+	return time.Time{}
+}
+
+func legacyString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMentionsConcurrentWithTake reproduces mentions arriving while /comeback takes them:
+// every mention must be taken exactly once, none lost to a read-modify-write of the record.
+func TestMentionsConcurrentWithTake(t *testing.T) {
+	const (
+		writers   = 4
+		perWriter = maxMentions / writers // stays within the trimmed length
+	)
+	eachStore(t, func(t *testing.T, s Store) {
+		var (
+			wg      sync.WaitGroup
+			done    = make(chan struct{})
+			takeErr error
+			taken   []Mention
+		)
+		go func() {
+			defer close(done)
+			for {
+				ms, err := s.TakeMentions("U1")
+				if err != nil {
+					takeErr = err
+					return
+				}
+				taken = append(taken, ms...)
+				if len(taken) >= writers*perWriter {
+					return
+				}
+			}
+		}()
+
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWriter; i++ {
+					m := Mention{Channel: "C1", User: "U2", Text: fmt.Sprintf("%d-%d", w, i), EventTS: fmt.Sprintf("%d.%d", w, i)}
+					if err := s.AddMention("U1", m); err != nil {
+						t.Errorf("AddMention: %v", err)
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("TakeMentions did not return every mention")
+		}
+		if takeErr != nil {
+			t.Fatal(takeErr)
+		}
+
+		seen := map[string]int{}
+		for _, m := range taken {
+			seen[m.Text]++
+		}
+		for w := 0; w < writers; w++ {
+			for i := 0; i < perWriter; i++ {
+				if n := seen[fmt.Sprintf("%d-%d", w, i)]; n != 1 {
+					t.Errorf("mention %d-%d taken %d times", w, i, n)
+				}
+			}
+		}
+		if len(taken) != writers*perWriter {
+			t.Errorf("took %d mentions, want %d", len(taken), writers*perWriter)
+		}
+		if rest, err := s.TakeMentions("U1"); err != nil || len(rest) != 0 {
+			t.Errorf("left over %v, %v", rest, err)
+		}
+	})
+}
+
+// TestUpdateUserPresenceConcurrent runs updates of one record at once; none may be lost.
+// An attempt only conflicts when another update commits, so with maxTxRetries updates every one gets through.
+func TestUpdateUserPresenceConcurrent(t *testing.T) {
+	const updates = maxTxRetries
+	eachStore(t, func(t *testing.T, s Store) {
+		var wg sync.WaitGroup
+		for i := 0; i < updates; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.UpdateUserPresence("U1", func(p *UserPresence) error {
+					p.Message += "x"
+					return nil
+				})
+				if err != nil {
+					t.Errorf("UpdateUserPresence: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		p, err := s.GetUserPresence("U1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Message) != updates {
+			t.Errorf("message has %d updates, want %d", len(p.Message), updates)
+		}
+	})
+}
+
+// TestUpdateUserPresenceGivesUp makes every transaction conflict with another writer:
+// the update must fail after maxTxRetries attempts instead of dropping the write silently
+func TestUpdateUserPresenceGivesUp(t *testing.T) {
+	r, mr := newTestRedis(t)
+	var attempts int32
+	err := r.UpdateUserPresence("U1", func(p *UserPresence) error {
+		n := atomic.AddInt32(&attempts, 1)
+		// another client changes the watched record between the read and EXEC
+		mr.Set(r.presenceKey("U1"), fmt.Sprintf(`{"version":%d,"message":"other %d"}`, PresenceVersion, n))
+		p.Message = "mine"
+		return nil
+	})
+	if err == nil {
+		t.Fatal("UpdateUserPresence succeeded although every attempt conflicted")
+	}
+	if attempts != maxTxRetries {
+		t.Errorf("attempted %d times, want %d", attempts, maxTxRetries)
+	}
+	p, err := r.GetUserPresence("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Message == "mine" {
+		t.Error("the conflicting update was written")
+	}
+}
@@ -2,7 +2,11 @@ package store
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,83 +15,160 @@ import (
 var ctx = context.Background()
 
 type RedisClient struct {
-	client *redis.Client
+	client redis.UniversalClient
+	base   string // REDIS_KEY_PREFIX, put in front of every key
+	prefix string // "<team ID>:" for a workspace, empty for keys shared by all workspaces
 }
 
-func NewRedisClient(url string) (*RedisClient, error) {
-	opt, err := redis.ParseURL(url)
-	if err != nil {
-		return nil, err
+// Options selects the Redis deployment. URL alone is a single node; its password, database and
+// rediss:// scheme also apply to the Sentinel and Cluster nodes.
+type Options struct {
+	URL            string
+	SentinelAddrs  []string // Sentinel nodes, used with SentinelMaster
+	SentinelMaster string
+	ClusterAddrs   []string // Cluster seed nodes
+	CAFile         string   // PEM bundle to verify the server certificate with; enables TLS
+	KeyPrefix      string
+}
+
+func NewRedisClient(opts Options) (*RedisClient, error) {
+	universal := &redis.UniversalOptions{}
+	if opts.URL != "" {
+		opt, err := redis.ParseURL(opts.URL)
+		if err != nil {
+			return nil, err
+		}
+		universal.Addrs = []string{opt.Addr}
+		universal.Username = opt.Username
+		universal.Password = opt.Password
+		universal.DB = opt.DB
+		universal.TLSConfig = opt.TLSConfig
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", opts.CAFile)
+		}
+		if universal.TLSConfig == nil {
+			universal.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		universal.TLSConfig.RootCAs = pool
 	}
 
-	client := redis.NewClient(opt)
-	_, err = client.Ping(ctx).Result()
-	if err != nil {
+	var client redis.UniversalClient
+	switch {
+	case opts.SentinelMaster != "":
+		if len(opts.SentinelAddrs) == 0 {
+			return nil, fmt.Errorf("no Sentinel address for master %q", opts.SentinelMaster)
+		}
+		universal.Addrs = opts.SentinelAddrs
+		universal.MasterName = opts.SentinelMaster
+		client = redis.NewFailoverClient(universal.Failover())
+	case len(opts.ClusterAddrs) > 0:
+		universal.Addrs = opts.ClusterAddrs
+		client = redis.NewClusterClient(universal.Cluster())
+	default:
+		if len(universal.Addrs) == 0 {
+			return nil, fmt.Errorf("no Redis address")
+		}
+		client = redis.NewClient(universal.Simple())
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
 	return &RedisClient{
 		client: client,
+		base:   opts.KeyPrefix,
 	}, nil
 }
 
-func (r *RedisClient) Set(key string, value string) error {
-	return r.client.Set(ctx, key, value, 0).Err()
+// ForTeam returns a client whose keys are namespaced by the Slack team ID.
+// It shares the connection with r.
+func (r *RedisClient) ForTeam(teamID string) Store {
+	return r.team(teamID)
 }
 
-func (r *RedisClient) Get(key string) (string, error) {
-	return r.client.Get(ctx, key).Result()
+func (r *RedisClient) team(teamID string) *RedisClient {
+	return &RedisClient{
+		client: r.client,
+		base:   r.base,
+		prefix: teamID + ":",
+	}
 }
 
-func (r *RedisClient) Expire(key string, duration time.Duration) error {
-	return r.client.Expire(ctx, key, duration).Err()
+// Close closes the connection shared by every team's client
+func (r *RedisClient) Close() error {
+	return r.client.Close()
 }
 
-func (r *RedisClient) AddToList(key string, value string) error {
-	err := r.client.LRem(ctx, key, 0, value).Err()
-	if err != nil {
-		return err
+func (r *RedisClient) key(k string) string {
+	return r.base + r.prefix + k
+}
+
+// shared returns the key of data shared by all workspaces
+func (r *RedisClient) shared(k string) string {
+	return r.base + k
+}
+
+// scanKeys returns every key matching pattern, from every master node of a cluster
+func (r *RedisClient) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	scanNode := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			keys = append(keys, iter.Val())
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node)
+		})
+		return keys, err
 	}
-	return r.client.LPush(ctx, key, value).Err()
+	return keys, scanNode(ctx, r.client)
 }
 
-func (r *RedisClient) GetListRange(key string, start, stop int64) ([]string, error) {
-	return r.client.LRange(ctx, key, start, stop).Result()
+func (r *RedisClient) Set(key string, value string) error {
+	return r.client.Set(ctx, r.key(key), value, 0).Err()
 }
 
-func (r *RedisClient) GetUserPresence(uid string) (map[string]interface{}, error) {
-	key := uid + "-store"
-	val, err := r.client.Get(ctx, key).Result()
+func (r *RedisClient) Get(key string) (string, error) {
+	val, err := r.client.Get(ctx, r.key(key)).Result()
 	if err == redis.Nil {
-		jst, _ := time.LoadLocation("Asia/Tokyo")
-		now := time.Now().In(jst)
-		return map[string]interface{}{
-			"last_active_start_time": now.Format(time.RFC3339),
-		}, nil
-	} else if err != nil {
-		return nil, err
+		return "", ErrNotFound
 	}
+	return val, err
+}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal([]byte(val), &result); err != nil {
-		return nil, err
-	}
-	return result, nil
+func (r *RedisClient) Expire(key string, duration time.Duration) error {
+	return r.client.Expire(ctx, r.key(key), duration).Err()
 }
 
-func (r *RedisClient) SetUserPresence(uid string, data map[string]interface{}) error {
-	key := uid + "-store"
-	jsonData, err := json.Marshal(data)
+// TTL returns the remaining time to live of a key. ok is false when the key does not exist,
+// and the duration is negative when the key has no expiry.
+func (r *RedisClient) TTL(key string) (time.Duration, bool, error) {
+	d, err := r.client.TTL(ctx, r.key(key)).Result()
 	if err != nil {
-		return err
+		return 0, false, err
 	}
-	return r.client.Set(ctx, key, string(jsonData), 30*24*time.Hour).Err()
+	if d == -2 {
+		return 0, false, nil
+	}
+	return d, true, nil
 }
 
 func (r *RedisClient) Delete(key string) error {
-	return r.client.Del(ctx, key).Err()
-}
-
-func (r *RedisClient) RemoveFromList(key string, value string) error {
-	return r.client.LRem(ctx, key, 0, value).Err()
+	return r.client.Del(ctx, r.key(key)).Err()
 }
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// registeredKey is the set of users whose auto-response is on.
+// Until 20261018-registered-list-to-set it was the "registered" list.
+const registeredKey = "registered-users"
+
+// Register adds uid to the users whose mentions get an auto-response
+func (r *RedisClient) Register(uid string) error {
+	return r.client.SAdd(ctx, r.key(registeredKey), uid).Err()
+}
+
+// Unregister removes uid from the users whose mentions get an auto-response
+func (r *RedisClient) Unregister(uid string) error {
+	return r.client.SRem(ctx, r.key(registeredKey), uid).Err()
+}
+
+// RegisteredUsers returns every registered user, sorted
+func (r *RedisClient) RegisteredUsers() ([]string, error) {
+	users, err := r.client.SMembers(ctx, r.key(registeredKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// FilterRegistered returns the users in uids that are registered, in the same order,
+// with a single SMISMEMBER round trip
+func (r *RedisClient) FilterRegistered(uids []string) ([]string, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	members := make([]interface{}, len(uids))
+	for i, uid := range uids {
+		members[i] = uid
+	}
+	found, err := r.client.SMIsMember(ctx, r.key(registeredKey), members...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var registered []string
+	for i, ok := range found {
+		if ok {
+			registered = append(registered, uids[i])
+		}
+	}
+	return registered, nil
+}
+
+// registeredListToSet moves the members of every team's "registered" list into its registered set.
+// The list of a single-workspace deployment, without a team, is left to namespaceLegacyKeys.
+func registeredListToSet(ctx context.Context, r *RedisClient, env MigrationEnv) error {
+	keys, err := r.scanKeys(ctx, r.shared("*:registered"))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		kind, err := r.client.Type(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if kind != "list" {
+			continue
+		}
+		if err := r.listToSet(ctx, key, key[:len(key)-len("registered")]+registeredKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listToSet moves the members of the registered list key into the registered set
+func (r *RedisClient) listToSet(ctx context.Context, key, set string) error {
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		users, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, uid := range users {
+				pipe.SAdd(ctx, set, uid)
+			}
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", key, err)
+	}
+	slog.Info("Converted registered list to a set", slog.String("key", key))
+	return nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterRegistered(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		for _, uid := range []string{"U1", "U3", "W5"} {
+			if err := s.Register(uid); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Unregister("U3"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.FilterRegistered([]string{"W5", "U2", "U3", "U1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"W5", "U1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("FilterRegistered = %v, want %v", got, want)
+		}
+		if got, err := s.FilterRegistered(nil); err != nil || got != nil {
+			t.Errorf("FilterRegistered(nil) = %v, %v", got, err)
+		}
+	})
+}
+
+// BenchmarkFilterRegistered compares the registered set with the list the bot used before:
+// LRANGE of every registered user and a strings.Contains per user over the message text
+func BenchmarkFilterRegistered(b *testing.B) {
+	const registered = 500
+	r, _ := newTestRedis(b)
+	for i := 0; i < registered; i++ {
+		uid := fmt.Sprintf("U%08d", i)
+		if err := r.Register(uid); err != nil {
+			b.Fatal(err)
+		}
+		if err := r.client.LPush(ctx, r.key("registered"), uid).Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	mentioned := []string{"U00000042", "U99999999", "U00000420"}
+	text := "<@U00000042> <@U99999999> 明日のリリースの件、<@U00000420> と確認しておいてください"
+
+	b.Run("smismember", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := r.FilterRegistered(mentioned); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("lrange-contains", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			users, err := r.client.LRange(ctx, r.key("registered"), 0, -1).Result()
+			if err != nil {
+				b.Fatal(err)
+			}
+			var found []string
+			for _, uid := range users {
+				if strings.Contains(text, "<@"+uid+">") {
+					found = append(found, uid)
+				}
+			}
+		}
+	})
+}
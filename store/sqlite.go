@@ -0,0 +1,513 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sweepInterval is how often the rows past their expiry are deleted.
+// Reads already skip them; the sweep only keeps the file from growing.
+const sweepInterval = time.Minute
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kv (
+	key        TEXT PRIMARY KEY,
+	value      TEXT NOT NULL,
+	expires_at INTEGER -- unix milliseconds, NULL when the key does not expire
+);
+CREATE INDEX IF NOT EXISTS kv_expires_at ON kv (expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS set_members (
+	key    TEXT NOT NULL,
+	member TEXT NOT NULL,
+	PRIMARY KEY (key, member)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS mentions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	key        TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mentions_key ON mentions (key, id);
+CREATE INDEX IF NOT EXISTS mentions_expires_at ON mentions (expires_at);
+
+CREATE TABLE IF NOT EXISTS installations (
+	team_id TEXT PRIMARY KEY,
+	data    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream TEXT NOT NULL,
+	data   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_stream ON audit (stream, id);
+`
+
+// SQLiteStore keeps the state in a single SQLite file, for deployments without Redis.
+// Keys are named as in Redis ("<team>:<uid>" and so on) but need no hash tags or REDIS_KEY_PREFIX.
+type SQLiteStore struct {
+	db     *sql.DB
+	prefix string        // "<team ID>:" for a workspace, empty for data shared by all workspaces
+	closer *sqliteCloser // shared with every team's store
+}
+
+// sqliteCloser stops the sweeper and closes the database only once,
+// whichever of the stores sharing them is closed and however often
+type sqliteCloser struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+// querier is a *sql.DB or a *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// NewSQLiteStore opens the database at path, creating it and its tables if needed,
+// and starts the sweeper of expired rows
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no SQLite database path")
+	}
+	// transactions take the write lock up front so that a concurrent writer waits instead of failing
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	// one connection serializes the bot's own writes, which SQLite would do anyway
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite schema in %s: %w", path, err)
+	}
+
+	s := &SQLiteStore{
+		db:     db,
+		closer: &sqliteCloser{stop: make(chan struct{}), done: make(chan struct{})},
+	}
+	go s.sweep()
+	return s, nil
+}
+
+// ForTeam returns a store whose keys are namespaced by the Slack team ID.
+// It shares the database with s.
+func (s *SQLiteStore) ForTeam(teamID string) Store {
+	return &SQLiteStore{
+		db:     s.db,
+		prefix: teamID + ":",
+		closer: s.closer,
+	}
+}
+
+// Close stops the sweeper and closes the database shared by every team's store.
+// Closing again, or closing another team's store, returns the result of the first Close.
+func (s *SQLiteStore) Close() error {
+	c := s.closer
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+		c.err = s.db.Close()
+	})
+	return c.err
+}
+
+// Migrate has nothing to do: the schema is created when the database is opened,
+// and no data was ever written in an older format
+func (s *SQLiteStore) Migrate(ctx context.Context, env MigrationEnv) ([]string, error) {
+	return nil, nil
+}
+
+func (s *SQLiteStore) key(k string) string {
+	return s.prefix + k
+}
+
+func (s *SQLiteStore) sweep() {
+	defer close(s.closer.done)
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closer.stop:
+			return
+		case <-ticker.C:
+			if err := s.deleteExpired(); err != nil {
+				slog.Error("Failed to delete expired rows", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func (s *SQLiteStore) deleteExpired() error {
+	now := time.Now().UnixMilli()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE expires_at <= ?`, now); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM mentions WHERE expires_at <= ?`, now)
+	return err
+}
+
+// expiresAt returns the expiry column value for a ttl from now, NULL when ttl is not positive
+func expiresAt(ttl time.Duration) interface{} {
+	if ttl <= 0 {
+		return nil
+	}
+	return time.Now().Add(ttl).UnixMilli()
+}
+
+// getValue reads a key that has not expired
+func getValue(q querier, key string) (string, error) {
+	var val string
+	err := q.QueryRowContext(ctx, `SELECT value FROM kv WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		key, time.Now().UnixMilli()).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return val, err
+}
+
+// setValue writes a key, replacing its value and expiry as Redis SET does
+func setValue(q querier, key, value string, ttl time.Duration) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO kv (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`,
+		key, value, expiresAt(ttl))
+	return err
+}
+
+func (s *SQLiteStore) Set(key string, value string) error {
+	return setValue(s.db, s.key(key), value, 0)
+}
+
+func (s *SQLiteStore) Get(key string) (string, error) {
+	return getValue(s.db, s.key(key))
+}
+
+// Expire sets the time to live of a key. Like Redis, a non-positive duration deletes the key.
+func (s *SQLiteStore) Expire(key string, duration time.Duration) error {
+	if duration <= 0 {
+		return s.Delete(key)
+	}
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `UPDATE kv SET expires_at = ? WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		now.Add(duration).UnixMilli(), s.key(key), now.UnixMilli())
+	return err
+}
+
+// TTL returns the remaining time to live of a key. ok is false when the key does not exist,
+// and the duration is negative when the key has no expiry.
+func (s *SQLiteStore) TTL(key string) (time.Duration, bool, error) {
+	now := time.Now().UnixMilli()
+	var expires sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT expires_at FROM kv WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		s.key(key), now).Scan(&expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	if !expires.Valid {
+		return -1, true, nil
+	}
+	return time.Duration(expires.Int64-now) * time.Millisecond, true, nil
+}
+
+func (s *SQLiteStore) Delete(key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE key = ?`, s.key(key))
+	return err
+}
+
+// Register adds uid to the users whose mentions get an auto-response
+func (s *SQLiteStore) Register(uid string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT OR IGNORE INTO set_members (key, member) VALUES (?, ?)`, s.key(registeredKey), uid)
+	return err
+}
+
+// Unregister removes uid from the users whose mentions get an auto-response
+func (s *SQLiteStore) Unregister(uid string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM set_members WHERE key = ? AND member = ?`, s.key(registeredKey), uid)
+	return err
+}
+
+// RegisteredUsers returns every registered user, sorted
+func (s *SQLiteStore) RegisteredUsers() ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT member FROM set_members WHERE key = ? ORDER BY member`, s.key(registeredKey))
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// FilterRegistered returns the users in uids that are registered, in the same order
+func (s *SQLiteStore) FilterRegistered(uids []string) ([]string, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{s.key(registeredKey)}
+	for _, uid := range uids {
+		args = append(args, uid)
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT member FROM set_members WHERE key = ? AND member IN (?`+
+		strings.Repeat(", ?", len(uids)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	members, err := scanStrings(rows)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, m := range members {
+		found[m] = true
+	}
+	var registered []string
+	for _, uid := range uids {
+		if found[uid] {
+			registered = append(registered, uid)
+		}
+	}
+	return registered, nil
+}
+
+func (s *SQLiteStore) presenceKey(uid string) string {
+	return s.key(uid + "-store")
+}
+
+func (s *SQLiteStore) mentionsKey(uid string) string {
+	return s.key(uid + "-mentions")
+}
+
+// GetUserPresence reads the presence of uid. A user without a record gets an empty one.
+func (s *SQLiteStore) GetUserPresence(uid string) (*UserPresence, error) {
+	p, err := readPresenceRow(s.db, s.presenceKey(uid))
+	if err != nil {
+		return nil, err
+	}
+	return &p.UserPresence, nil
+}
+
+// UpdateUserPresence applies fn to the presence of uid and stores the result in one transaction
+func (s *SQLiteStore) UpdateUserPresence(uid string, fn func(p *UserPresence) error) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		stored, err := readPresenceRow(tx, s.presenceKey(uid))
+		if err != nil {
+			return err
+		}
+		p := stored.UserPresence
+		if err := fn(&p); err != nil {
+			return err
+		}
+		data, err := encodePresence(&p)
+		if err != nil {
+			return err
+		}
+		if err := setValue(tx, s.presenceKey(uid), data, presenceTTL); err != nil {
+			return err
+		}
+		if p.clearMentions {
+			_, err = tx.ExecContext(ctx, `DELETE FROM mentions WHERE key = ?`, s.mentionsKey(uid))
+		}
+		return err
+	})
+}
+
+// AddMention appends a mention to the list of uid, keeping the latest maxMentions
+func (s *SQLiteStore) AddMention(uid string, m Mention) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := s.mentionsKey(uid)
+	return s.inTx(func(tx *sql.Tx) error {
+		// like the Redis list, the whole list expires presenceTTL after the last mention
+		expires := expiresAt(presenceTTL)
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mentions (key, data, expires_at) VALUES (?, ?, ?)`, key, string(data), expires); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE mentions SET expires_at = ? WHERE key = ?`, expires, key); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM mentions WHERE key = ? AND id <= (
+			SELECT id FROM mentions WHERE key = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`, key, key, maxMentions)
+		return err
+	})
+}
+
+// TakeMentions returns the mentions of uid in the order they arrived and empties the list
+func (s *SQLiteStore) TakeMentions(uid string) ([]Mention, error) {
+	key := s.mentionsKey(uid)
+	var taken []Mention
+	err := s.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT data FROM mentions WHERE key = ? AND expires_at > ? ORDER BY id`, key, time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+		items, err := scanStrings(rows)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			var m Mention
+			if err := json.Unmarshal([]byte(item), &m); err != nil {
+				return err
+			}
+			taken = append(taken, m)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM mentions WHERE key = ?`, key)
+		return err
+	})
+	return taken, err
+}
+
+// FirstSeen reports whether id is seen for the first time within ttl, and remembers it
+func (s *SQLiteStore) FirstSeen(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	// the insert only takes over an existing row when it has expired
+	res, err := s.db.ExecContext(ctx, `INSERT INTO kv (key, value, expires_at) VALUES (?, '1', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at
+		WHERE kv.expires_at IS NOT NULL AND kv.expires_at <= ?`,
+		dedupPrefix+id, expiresAt(ttl), time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ForgetSeen forgets id, so that FirstSeen reports it as first again
+func (s *SQLiteStore) ForgetSeen(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE key = ?`, dedupPrefix+id)
+	return err
+}
+
+// SaveInstallation stores or replaces the installation of a team
+func (s *SQLiteStore) SaveInstallation(ctx context.Context, inst Installation) error {
+	data, err := json.Marshal(inst)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO installations (team_id, data) VALUES (?, ?)
+		ON CONFLICT (team_id) DO UPDATE SET data = excluded.data`, inst.TeamID, string(data))
+	return err
+}
+
+// GetInstallation returns the installation of a team, or nil when the team has not installed the app
+func (s *SQLiteStore) GetInstallation(ctx context.Context, teamID string) (*Installation, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM installations WHERE team_id = ?`, teamID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var inst Installation
+	if err := json.Unmarshal([]byte(data), &inst); err != nil {
+		return nil, err
+	}
+	return &inst, nil
+}
+
+// DeleteInstallation forgets the bot token of a team
+func (s *SQLiteStore) DeleteInstallation(ctx context.Context, teamID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM installations WHERE team_id = ?`, teamID)
+	return err
+}
+
+// SaveOAuthState remembers a state parameter of the install flow for ttl
+func (s *SQLiteStore) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	return setValue(s.db, oauthStatePrefix+state, "1", ttl)
+}
+
+// ConsumeOAuthState reports whether state was issued and not used yet, and invalidates it
+func (s *SQLiteStore) ConsumeOAuthState(ctx context.Context, state string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM kv WHERE key = ? AND (expires_at IS NULL OR expires_at > ?)`,
+		oauthStatePrefix+state, time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// AppendAudit appends an entry to the audit stream and to the stream of each user it concerns
+func (s *SQLiteStore) AppendAudit(ctx context.Context, userIDs []string, data string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if err := appendStream(ctx, tx, s.key(auditKey), data, auditMaxLen); err != nil {
+			return err
+		}
+		for _, uid := range userIDs {
+			if err := appendStream(ctx, tx, s.key(auditKey+":"+uid), data, auditUserMaxLen); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AuditHistory returns the latest audit entries concerning a user, newest first
+func (s *SQLiteStore) AuditHistory(ctx context.Context, uid string, count int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM audit WHERE stream = ? ORDER BY id DESC LIMIT ?`, s.key(auditKey+":"+uid), count)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// appendStream adds data to stream and drops the entries beyond the latest maxLen
+func appendStream(ctx context.Context, tx *sql.Tx, stream, data string, maxLen int) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO audit (stream, data) VALUES (?, ?)`, stream, data); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM audit WHERE stream = ? AND id <= (
+		SELECT id FROM audit WHERE stream = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`, stream, stream, maxLen)
+	return err
+}
+
+// inTx runs fn in a transaction, committing when it returns nil
+func (s *SQLiteStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// readPresenceRow reads the presence record at key with q, which may be the database or a transaction
+func readPresenceRow(q querier, key string) (*storedPresence, error) {
+	val, err := getValue(q, key)
+	if err == ErrNotFound {
+		return &storedPresence{UserPresence: UserPresence{Version: PresenceVersion, Since: time.Now()}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decodePresence([]byte(val))
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
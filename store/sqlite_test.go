@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLiteKeyValue(t *testing.T) {
+	s := newTestSQLite(t)
+
+	if _, err := s.Get("U1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key: %v", err)
+	}
+	if _, ok, err := s.TTL("U1"); err != nil || ok {
+		t.Fatalf("TTL of a missing key = %v, %v", ok, err)
+	}
+
+	if err := s.Set("U1", "ランチ中です"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get("U1"); err != nil || v != "ランチ中です" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if ttl, ok, err := s.TTL("U1"); err != nil || !ok || ttl >= 0 {
+		t.Fatalf("TTL without expiry = %v, %v, %v", ttl, ok, err)
+	}
+
+	if err := s.Expire("U1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, ok, err := s.TTL("U1"); err != nil || !ok || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("TTL after Expire = %v, %v, %v", ttl, ok, err)
+	}
+	// Set replaces the expiry as Redis SET does
+	if err := s.Set("U1", "会議中です"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _, _ := s.TTL("U1"); ttl >= 0 {
+		t.Fatalf("TTL after Set = %v", ttl)
+	}
+
+	if err := s.Expire("U1", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := s.Get("U1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of an expired key: %v", err)
+	}
+	if err := s.Expire("U1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.TTL("U1"); ok {
+		t.Fatal("Expire brought back an expired key")
+	}
+
+	if err := s.Set("U2", "外出中です"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Expire("U2", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("U2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Expire(0): %v", err)
+	}
+	if err := s.Set("U3", "休憩中です"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("U3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("U3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: %v", err)
+	}
+}
+
+func TestSQLitePresenceAndMentions(t *testing.T) {
+	s := newTestSQLite(t)
+
+	p, err := s.GetUserPresence("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != "" || !p.Begin.IsZero() {
+		t.Fatalf("presence of a new user = %+v", p)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	err = s.UpdateUserPresence("U1", func(p *UserPresence) error {
+		p.SetStatus(StatusLunch, "ランチ中です", now, now.Add(time.Hour))
+		p.Begin = now.Add(-3 * time.Hour)
+		p.Location = "office"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = s.GetUserPresence("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != PresenceVersion || p.Status != StatusLunch || p.Message != "ランチ中です" || p.Location != "office" ||
+		!p.Since.Equal(now) || !p.ReturnAt.Equal(now.Add(time.Hour)) || !p.Begin.Equal(now.Add(-3*time.Hour)) {
+		t.Fatalf("presence = %+v", p)
+	}
+
+	// an error from fn leaves the record as it was
+	err = s.UpdateUserPresence("U1", func(p *UserPresence) error {
+		p.Location = "remote"
+		return fmt.Errorf("cancelled")
+	})
+	if err == nil {
+		t.Fatal("UpdateUserPresence ignored the error of fn")
+	}
+	if p, _ := s.GetUserPresence("U1"); p.Location != "office" {
+		t.Fatalf("Location after a failed update = %q", p.Location)
+	}
+
+	mentions := []Mention{
+		{Channel: "C1", User: "U2", Text: "<@U1> 一つ目", EventTS: "1.0"},
+		{Channel: "C1", User: "U3", Text: "<@U1> 二つ目", EventTS: "2.0"},
+	}
+	for _, m := range mentions {
+		if err := s.AddMention("U1", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	taken, err := s.TakeMentions("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(taken, mentions) {
+		t.Fatalf("TakeMentions = %+v, want %+v", taken, mentions)
+	}
+	if taken, _ := s.TakeMentions("U1"); len(taken) != 0 {
+		t.Fatalf("TakeMentions again = %+v", taken)
+	}
+
+	// a new status forgets the mentions of the previous one
+	if err := s.AddMention("U1", mentions[0]); err != nil {
+		t.Fatal(err)
+	}
+	err = s.UpdateUserPresence("U1", func(p *UserPresence) error {
+		p.SetStatus(StatusAfk, "", now, time.Time{})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if taken, _ := s.TakeMentions("U1"); len(taken) != 0 {
+		t.Fatalf("mentions after a new status = %+v", taken)
+	}
+
+	for i := 0; i < maxMentions+5; i++ {
+		if err := s.AddMention("U1", Mention{EventTS: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	taken, err = s.TakeMentions("U1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taken) != maxMentions || taken[0].EventTS != "5" {
+		t.Fatalf("kept %d mentions from %q, want %d from \"5\"", len(taken), taken[0].EventTS, maxMentions)
+	}
+}
+
+func TestSQLiteTeamIsolation(t *testing.T) {
+	s := newTestSQLite(t)
+	a, b := s.ForTeam("T0001"), s.ForTeam("T0002")
+	ctx := context.Background()
+
+	if err := a.Set("U1", "A の自動応答"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get("U1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("another team's Get: %v", err)
+	}
+	if _, err := s.Get("U1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("shared Get: %v", err)
+	}
+
+	if err := a.Register("U1"); err != nil {
+		t.Fatal(err)
+	}
+	if users, _ := b.RegisteredUsers(); len(users) != 0 {
+		t.Errorf("another team's registered = %v", users)
+	}
+	if users, _ := b.FilterRegistered([]string{"U1"}); len(users) != 0 {
+		t.Errorf("another team's FilterRegistered = %v", users)
+	}
+
+	err := a.UpdateUserPresence("U1", func(p *UserPresence) error {
+		p.Location = "office"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := b.GetUserPresence("U1"); p.Location != "" {
+		t.Errorf("another team's presence = %+v", p)
+	}
+	if err := a.AddMention("U1", Mention{Text: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if taken, _ := b.TakeMentions("U1"); len(taken) != 0 {
+		t.Errorf("another team's mentions = %+v", taken)
+	}
+	if taken, _ := a.TakeMentions("U1"); len(taken) != 1 {
+		t.Errorf("mentions = %+v", taken)
+	}
+
+	// installations are shared by the stores of every team
+	if err := a.SaveInstallation(ctx, Installation{TeamID: "T0002", TeamName: "B", BotToken: "xoxb-b"}); err != nil {
+		t.Fatal(err)
+	}
+	if inst, err := b.GetInstallation(ctx, "T0002"); err != nil || inst == nil || inst.BotToken != "xoxb-b" {
+		t.Errorf("GetInstallation = %+v, %v", inst, err)
+	}
+}
+
+func TestSQLiteReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "afk.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ForTeam("T0001").Set("U1", "会議中です"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v, err := s.ForTeam("T0001").Get("U1"); err != nil || v != "会議中です" {
+		t.Errorf("Get after reopening = %q, %v", v, err)
+	}
+}
+
+func TestSQLiteCloseTwice(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "afk.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	team := s.ForTeam("T0001")
+	if err := team.Close(); err != nil {
+		t.Fatalf("Close of a team's store: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close after a team's store was closed: %v", err)
+	}
+	if err := team.Close(); err != nil {
+		t.Fatalf("Close again: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Get when the key does not exist or has expired
+var ErrNotFound = errors.New("store: key not found")
+
+// Store is the state of the bot. RedisClient and SQLiteStore implement it.
+type Store interface {
+	// ForTeam returns a store whose data is namespaced by the Slack team ID.
+	// It shares the connection with the store it was made from.
+	ForTeam(teamID string) Store
+	// Close closes the connection shared by every team's store
+	Close() error
+	// Migrate brings the stored data up to date and returns the IDs of the migrations it applied
+	Migrate(ctx context.Context, env MigrationEnv) ([]string, error)
+
+	// Away messages: the "<uid>" key holds the auto-response, and its expiry ends it
+	Set(key string, value string) error
+	Get(key string) (string, error)
+	Expire(key string, duration time.Duration) error
+	TTL(key string) (time.Duration, bool, error)
+	Delete(key string) error
+
+	Register(uid string) error
+	Unregister(uid string) error
+	RegisteredUsers() ([]string, error)
+	FilterRegistered(uids []string) ([]string, error)
+
+	GetUserPresence(uid string) (*UserPresence, error)
+	UpdateUserPresence(uid string, fn func(p *UserPresence) error) error
+	AddMention(uid string, m Mention) error
+	TakeMentions(uid string) ([]Mention, error)
+
+	FirstSeen(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	ForgetSeen(ctx context.Context, id string) error
+
+	SaveInstallation(ctx context.Context, inst Installation) error
+	GetInstallation(ctx context.Context, teamID string) (*Installation, error)
+	DeleteInstallation(ctx context.Context, teamID string) error
+	SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error
+	ConsumeOAuthState(ctx context.Context, state string) (bool, error)
+
+	AppendAudit(ctx context.Context, userIDs []string, data string) error
+	AuditHistory(ctx context.Context, uid string, count int64) ([]string, error)
+}
+
+// sqliteScheme selects the embedded SQLite store, e.g. sqlite:///var/lib/afk/afk.db
+const sqliteScheme = "sqlite://"
+
+// Open connects to the store selected by opts: SQLite when the URL is sqlite://<path>, Redis otherwise
+func Open(opts Options) (Store, error) {
+	if path, ok := strings.CutPrefix(opts.URL, sqliteScheme); ok {
+		s, err := NewSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	r, err := NewRedisClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}